@@ -12,18 +12,19 @@ const Forecast: React.FC<ForecastProps> = ({ data }) => {
 
     const forecast = data?.daily || [];
 
-    const getDayString = (date: number, long: boolean = false): string => {
-        const d = new Date(date * 1000);
+    const getDayString = (date: string, long: boolean = false): string => {
+        // Dates are calendar days in the location's timezone, read them at noon UTC to get the same weekday everywhere
+        const d = new Date(date + 'T12:00:00Z');
         const shortDayNames = ['Sun', 'Mon', 'Tue', 'Wed', 'Thu', 'Fri', 'Sat'];
         const longDayNames = ['Sunday', 'Monday', 'Tuesday', 'Wednesday', 'Thursday', 'Friday', 'Saturday'];    
-        return long ? longDayNames[d.getDay()] : shortDayNames[d.getDay()];
+        return long ? longDayNames[d.getUTCDay()] : shortDayNames[d.getUTCDay()];
     }
 
     const chartData = forecast.map(d => ({
-        day: getDayString(d.dt, true),
-        tempNight: d.temp.night + '°',
-        valueTxt: d.temp.day + '°',
-        value: d.temp.day,
+        day: getDayString(d.date, true),
+        tempNight: Math.round(d.temperatureMin) + '°',
+        valueTxt: Math.round(d.temperatureMax) + '°',
+        value: d.temperatureMax,
     }));
 
     return (
@@ -64,12 +65,12 @@ const Forecast: React.FC<ForecastProps> = ({ data }) => {
                             forecast.map((day, index) => (
                                 <div key={index} className={styles.forecastDay}>
                                     <div className={styles.forecastDate}>
-                                        {getDayString(day.dt)}
+                                        {getDayString(day.date)}
                                     </div>
                                     <WeatherIcon size={32} weatherData={day} />
                                     <div className={styles.forecastTemp}>
-                                        <span className={styles.day}>{Math.round(day.temp.day)}°</span>
-                                        <span className={styles.night}>{Math.round(day.temp.night)}°</span>
+                                        <span className={styles.day}>{Math.round(day.temperatureMax)}°</span>
+                                        <span className={styles.night}>{Math.round(day.temperatureMin)}°</span>
                                     </div>
                                 </div>
                             ))
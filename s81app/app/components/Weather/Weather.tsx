@@ -9,15 +9,15 @@ interface WeatherProps {
 
 const Weather: React.FC<WeatherProps> = ({ data }) => {
     const getTemp = (temp: number | undefined) => {
-        if (!temp) return "";
-        return Math.round(temp) + "°F";
+        if (temp === undefined) return "";
+        return Math.round(temp) + (data?.units.temperature ?? "°F");
     }
 
     return (
         <div className={sharedStyles.widget}>
             <h2>Weather</h2>
             <div className={`${sharedStyles.widgetContent} ${styles.weatherContent}`}>
-                <div className={styles.temp}>{getTemp(data?.current?.temp)}</div>
+                <div className={styles.temp}>{getTemp(data?.current?.temperature)}</div>
                 <WeatherIcon size={130} weatherData={data?.current}/>
             </div>
         </div>
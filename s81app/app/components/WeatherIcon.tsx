@@ -20,43 +20,29 @@ const WeatherIcon: React.FC<WeatherIconProps> = ({ weatherData, size = 16 }) =>
     if (!weatherData) {
         iconSrc = sunCloud;
     } else {
-        switch (weatherData.weather[0].icon) {
-            case '01d':
-            case '01n':
+        switch (weatherData.condition) {
+            case 'clear':
                 iconSrc = sun;
                 break;
-            case '02d':
-            case '02n':
+            case 'partly-cloudy':
                 iconSrc = sunCloud;
                 break;
-            case '03d':
-            case '03n':
+            case 'cloudy':
+            case 'fog':
                 iconSrc = cloud;
                 break;
-            case '04d':
-            case '04n':
-                iconSrc = cloud;
-                break;
-            case '09d':
-            case '09n':
+            case 'rain':
                 iconSrc = rain;
                 break;
-            case '10d':
-            case '10n':
+            case 'showers':
                 iconSrc = suncloudrain;
                 break;
-            case '11d':
-            case '11n':
+            case 'thunderstorm':
                 iconSrc = lightning;
                 break;
-            case '13d':
-            case '13n':
+            case 'snow':
                 iconSrc = snow;
                 break;
-            case '50d':
-            case '50n':
-                iconSrc = cloud;
-                break;
             default:
                 iconSrc = sunCloud;
                 break;
@@ -1,62 +1,154 @@
 "use client";
 
-import React, { useState, useEffect } from 'react';
+import React, { useState, useEffect, useRef, useCallback } from 'react';
 import useWebSocket, { ReadyState } from 'react-use-websocket';
 import styles from './page.module.scss';
 import Weather from './components/Weather/Weather';
 import Forecast from './components/Forecast/Forecast';
 import Subway from './components/Subway/Subway';
-import { Direction, mapSubwayData, SubwayArrival } from './models/subwayData';
+import { CLOSE_POLICY_VIOLATION, isTokenExpired } from './models/token';
+import { Direction, applyDelta, ArrivalsState, mapArrivalsData, snapshotState, SubwayArrival } from './models/subwayData';
+
+// Topics subscribed to when connecting
+const TOPICS = ['arrivals-s81-delta', 'weather-data'];
+// Kafka key of the weather location shown, s81 in the weather producer's default configuration
+const WEATHER_KEY = 'weather';
 
 type WebSocketMessage = {
-  key: 'weather-data' | 'subway-a' | 'subway-b' | 'subway-c';
+  key: 'weather-data' | 'arrivals-s81' | 'arrivals-s81-delta';
+  messageKey: string;
   value: string;
+  partition: number;
+  offset: number;
+  seq: number;
 };
 
 const Main: React.FC = () => {
   const WS_URL = 'ws://localhost:8081/ws';
-  const { lastJsonMessage, readyState } = useWebSocket(WS_URL, {
+  // Token for servers that require authentication
+  const WS_TOKEN = process.env.NEXT_PUBLIC_WS_TOKEN;
+  // Last received position of each topic, passed when reconnecting to get the messages missed in between
+  const positions = useRef<{ [topic: string]: string }>({});
+  const getUrl = useCallback(() => {
+    // Only receive the topics this dashboard renders, the server replays them from the resume positions
+    const params = new URLSearchParams({ topics: TOPICS.join(',') });
+    if (WS_TOKEN) {
+      params.set('token', WS_TOKEN);
+    }
+    const resume = Object.entries(positions.current)
+      .map(([topic, position]) => `${topic}:${position}`)
+      .join(',');
+    if (resume) {
+      params.set('resume', resume);
+    }
+    return `${WS_URL}?${params.toString()}`;
+  }, [WS_URL, WS_TOKEN]);
+
+  // Set when the token is rejected, reconnecting with the same token would fail forever
+  const [authError, setAuthError] = useState<string | undefined>(
+    WS_TOKEN && isTokenExpired(WS_TOKEN) ? 'The access token has expired' : undefined,
+  );
+  const { sendJsonMessage, lastJsonMessage, readyState } = useWebSocket(getUrl, {
     share: true,
-    shouldReconnect: () => true,
-  });
+    shouldReconnect: (event) => {
+      // The server closes with 1008 when the token expires, and answers the upgrade with 401 once it has
+      if (event.code === CLOSE_POLICY_VIOLATION || (WS_TOKEN && isTokenExpired(WS_TOKEN))) {
+        setAuthError('The access token has expired');
+        return false;
+      }
+      return true;
+    },
+  }, !authError);
 
   // State for different message types
   const [weather, setWeather] = useState<WeatherData | undefined>(undefined);
-  const [subwayA, setSubwayA] = useState<SubwayArrival[]>([]);
-  const [subwayB, setSubwayB] = useState<SubwayArrival[]>([]);
-  const [subwayC, setSubwayC] = useState<SubwayArrival[]>([]);
-  // const [subwayData, setSubwayData] = useState<SubwayArrival[]>([]);
+  const [subwayData, setSubwayData] = useState<SubwayArrival[]>([]);
+  const arrivals = useRef<ArrivalsState | undefined>(undefined);
+  // Set while a snapshot request is unanswered, deltas arriving before the snapshot must not request another one
+  const snapshotPending = useRef(false);
+
+  const requestSnapshot = useCallback(() => {
+    if (!snapshotPending.current) {
+      snapshotPending.current = true;
+      sendJsonMessage({ op: 'snapshot', topics: ['arrivals-s81'] });
+    }
+  }, [sendJsonMessage]);
+
+  const showArrivals = (state: ArrivalsState) => {
+    arrivals.current = state;
+    setSubwayData(mapArrivalsData({ arrivals: Object.values(state.arrivals) }));
+  };
+
+  // Request the arrivals the deltas apply to, after a reconnect the missed deltas are replayed instead.
+  // A request still pending when the connection dropped is never answered, so it is forgotten.
+  useEffect(() => {
+    if (readyState !== ReadyState.OPEN) {
+      snapshotPending.current = false;
+    } else if (!arrivals.current) {
+      requestSnapshot();
+    }
+  }, [readyState, requestSnapshot]);
+
+  // Arrivals only change on deltas, so count the minutes down in between
+  useEffect(() => {
+    const interval = setInterval(() => {
+      if (arrivals.current) {
+        showArrivals(arrivals.current);
+      }
+    }, 30000);
+    return () => clearInterval(interval);
+  }, []);
 
   // Effect to handle new messages
   useEffect(() => {
     if (lastJsonMessage) {
       const message: WebSocketMessage = lastJsonMessage as WebSocketMessage;
+      positions.current[message.key] = `${message.partition}:${message.offset}`;
       console.log('Received message:', message);
 
       // Update the state based on the message key
       switch (message.key) {
-        case 'weather-data':
-          setWeather(JSON.parse(message.value));
+        case 'weather-data': {
+          // Other locations share the topic, the server replays the latest message of each
+          if (message.messageKey !== WEATHER_KEY) {
+            break;
+          }
+          // Ignore messages in a schema version this client does not understand
+          const weatherData: WeatherData = JSON.parse(message.value);
+          if (weatherData.schemaVersion === 1) {
+            setWeather(weatherData);
+          } else {
+            console.error('Unsupported weather schema version:', weatherData.schemaVersion);
+          }
           break;
-        case 'subway-a':
-          setSubwayA(mapSubwayData(JSON.parse(message.value)));
+        }
+        case 'arrivals-s81':
+          snapshotPending.current = false;
+          showArrivals(snapshotState(JSON.parse(message.value)));
           break;
-        case 'subway-b':
-          setSubwayB(mapSubwayData(JSON.parse(message.value)));
-          break;
-        case 'subway-c':
-          setSubwayC(mapSubwayData(JSON.parse(message.value)));
+        case 'arrivals-s81-delta': {
+          // Deltas before the first snapshot are covered by it, a missed delta needs a new one
+          if (!arrivals.current) {
+            requestSnapshot();
+            break;
+          }
+          const state = applyDelta(arrivals.current, JSON.parse(message.value));
+          if (state) {
+            showArrivals(state);
+          } else {
+            requestSnapshot();
+          }
           break;
+        }
         default:
           console.error('Unknown message key:', message.key);
       }
     }
-  }, [lastJsonMessage]);
-
-  const subwayData = [...subwayA, ...subwayB, ...subwayC].sort((a, b) => a.arrivalMinutes - b.arrivalMinutes);
+  }, [lastJsonMessage, requestSnapshot]);
 
   return (
     <main className={styles.main}>
+      {authError && <p className={styles.error} role="alert">{authError}</p>}
       <Weather data={weather} />
       <Forecast data={weather} />
       <Subway arrivals={subwayData} direction={Direction.North} />
@@ -1,41 +1,46 @@
 import moment from 'moment-timezone';
 
-// Define the structure for arrival and departure times
-interface TimeUpdate {
-    time: number;
-}
-
-// Define the structure for stop time updates
-interface StopTimeUpdate {
-    stop_id: string;
-    arrival: TimeUpdate;
-    departure: TimeUpdate;
-    departure_occupancy_status: number;
+// Define the structure for a normalized arrival published by the subway-producer
+interface Arrival {
+    line: string;
+    direction: string;
+    stopId: string;
+    tripId: string;
+    arrivalTime: number;
+    delay: number;
+    scheduleRelationship: string;
 }
 
-// Define the structure for trip details
-interface Trip {
-    trip_id: string;
-    route_id: string;
-    start_time: string;
-    start_date: string;
+// Define the structure for the arrivals-s81 message, the snapshot that arrivals deltas apply to
+export interface ArrivalsMessage {
+    generatedAt: number;
+    epoch: number;
+    sequences: { [line: string]: number };
+    arrivals: Arrival[];
 }
 
-// Define the structure for trip updates
-interface TripUpdate {
-    trip: Trip;
-    stop_time_update: StopTimeUpdate[];
+// Define the structure for a JSON-patch-style change to a line's arrivals
+interface ArrivalOp {
+    op: 'add' | 'remove' | 'replace';
+    path: string;
+    value?: Arrival;
 }
 
-// Define the structure for each entity
-interface Entity {
-    id: string;
-    trip_update: TripUpdate;
+// Define the structure for the arrivals-s81-delta message, sent when a line's arrivals change
+export interface ArrivalsDelta {
+    station: string;
+    line: string;
+    epoch: number;
+    sequence: number;
+    generatedAt: number;
+    ops: ArrivalOp[];
 }
 
-// Define the structure for the entire response
-export interface SubwayData {
-    entity: Entity[];
+// Define the arrivals kept by a client following deltas, keyed by the path used in the ops
+export interface ArrivalsState {
+    epoch: number;
+    sequences: { [line: string]: number };
+    arrivals: { [path: string]: Arrival };
 }
 
 export enum Direction {
@@ -60,30 +65,52 @@ const convertSecondsToMinutes = (seconds: number): number => {
 // Define the maximum display time for subway arrivals
 export const MAX_DISPLAY_MINUTES = 30;
 
-export const mapSubwayData = (data: SubwayData): SubwayArrival[] => {
+// Function to build the path of an arrival, escaped as a JSON pointer like the producer does
+const arrivalPath = (arrival: Arrival): string => {
+    return '/arrivals/' + `${arrival.tripId}:${arrival.stopId}`.replace(/~/g, '~0').replace(/\//g, '~1');
+}
+
+export const snapshotState = (data: ArrivalsMessage): ArrivalsState => {
+    const arrivals: { [path: string]: Arrival } = {};
+    (data.arrivals ?? []).forEach(arrival => {
+        arrivals[arrivalPath(arrival)] = arrival;
+    });
+    return { epoch: data.epoch, sequences: data.sequences ?? {}, arrivals };
+};
+
+// Apply a delta to the arrivals. Deltas the state already includes are ignored,
+// undefined is returned if a delta was missed and a new snapshot is needed.
+export const applyDelta = (state: ArrivalsState, delta: ArrivalsDelta): ArrivalsState | undefined => {
+    const sequence = state.sequences[delta.line] ?? 0;
+    if (delta.epoch === state.epoch && delta.sequence <= sequence) return state;
+    if (delta.epoch !== state.epoch || delta.sequence !== sequence + 1) return undefined;
+
+    const arrivals = { ...state.arrivals };
+    delta.ops.forEach(op => {
+        if (op.op === 'remove') {
+            delete arrivals[op.path];
+        } else if (op.value) {
+            arrivals[op.path] = op.value;
+        }
+    });
+    return { ...state, sequences: { ...state.sequences, [delta.line]: delta.sequence }, arrivals };
+};
+
+export const mapArrivalsData = (data: Pick<ArrivalsMessage, 'arrivals'>): SubwayArrival[] => {
     const currentTime = Math.floor(moment().tz('America/New_York').unix());
 
-    if (!data.entity) return [];
-
-    return data.entity.flatMap(entity => {
-        const tripUpdate = entity.trip_update;
-        if (!tripUpdate) return [];
-        let line = tripUpdate.trip.route_id;
-        if(line === 'D') line = 'B';
-        if (line !== 'A' && line !== 'B' && line !== 'C') return [];
-
-        return tripUpdate.stop_time_update.map(stopTimeUpdate => {
-            const arrivalTime = stopTimeUpdate.arrival.time;
-            const arrivalMinutes = convertSecondsToMinutes(arrivalTime - currentTime);
-
-            return {
-                tripId: tripUpdate.trip.trip_id,
-                line,
-                arrivalMinutes: Math.max(arrivalMinutes, 0), // Ensure non-negative values
-                arrivalSeconds: arrivalMinutes * 60,
-                direction: stopTimeUpdate.stop_id.includes('N') ? Direction.North : Direction.South
-            };
-        });
+    if (!data.arrivals) return [];
+
+    return data.arrivals.map(arrival => {
+        const arrivalMinutes = convertSecondsToMinutes(arrival.arrivalTime - currentTime);
+
+        return {
+            tripId: arrival.tripId,
+            line: arrival.line,
+            arrivalMinutes: Math.max(arrivalMinutes, 0), // Ensure non-negative values
+            arrivalSeconds: arrivalMinutes * 60,
+            direction: arrival.direction === Direction.North ? Direction.North : Direction.South
+        };
     })
     //filter out 0 arrival times and arrival times greater than MAX_DISPLAY_TIME minutes
     .filter((arrival) => arrival.arrivalMinutes > 0 && arrival.arrivalMinutes < MAX_DISPLAY_MINUTES)
@@ -1,97 +1,43 @@
-// Define the structure for weather conditions
-interface WeatherCondition {
-  id: number;
-  main: string;
-  description: string;
-  icon: string;
-}
+// Define the structure of the weather messages published by the weather producer, see weather-producer/SCHEMA.md
 
-// Define the structure for current weather data
-interface CurrentWeather {
-  dt: number;
-  sunrise: number;
-  sunset: number;
-  temp: number;
-  feels_like: number;
-  pressure: number;
-  humidity: number;
-  dew_point: number;
-  uvi: number;
-  clouds: number;
-  visibility: number;
-  wind_speed: number;
-  wind_deg: number;
-  weather: WeatherCondition[];
-}
+// Define the sky conditions every weather provider is mapped into
+type WeatherCondition = 'clear' | 'partly-cloudy' | 'cloudy' | 'showers' | 'rain' | 'thunderstorm' | 'snow' | 'fog';
 
-// Define the structure for minutely data
-interface MinutelyData {
-  dt: number;
-  precipitation: number;
+// Define the units of the values in a weather message
+interface WeatherUnits {
+  temperature: string;
+  windSpeed: string;
+  probability: string;
 }
 
-// Define the structure for hourly weather data
-interface HourlyWeather {
-  dt: number;
-  temp: number;
-  feels_like: number;
-  pressure: number;
-  humidity: number;
-  dew_point: number;
-  uvi: number;
-  clouds: number;
-  visibility: number;
-  wind_speed: number;
-  wind_deg: number;
-  wind_gust?: number; // Optional since it may not always be present
-  weather: WeatherCondition[];
-  pop: number;
+// Define the structure for current weather data
+interface CurrentWeather {
+  time: string; // RFC 3339 in the location's timezone
+  temperature: number;
+  feelsLike: number;
+  windSpeed: number;
+  condition: WeatherCondition;
+  description?: string;
+  isDay: boolean;
 }
 
 // Define the structure for daily weather data
 interface DailyWeather {
-  dt: number;
-  sunrise: number;
-  sunset: number;
-  moonrise: number;
-  moonset: number;
-  moon_phase: number;
-  summary: string;
-  temp: {
-      day: number;
-      min: number;
-      max: number;
-      night: number;
-      eve: number;
-      morn: number;
-  };
-  feels_like: {
-      day: number;
-      night: number;
-      eve: number;
-      morn: number;
-  };
-  pressure: number;
-  humidity: number;
-  dew_point: number;
-  wind_speed: number;
-  wind_deg: number;
-  wind_gust: number;
-  weather: WeatherCondition[];
-  clouds: number;
-  pop: number;
-  rain?: number; // Optional since it may not always be present
-  uvi: number;
+  date: string; // YYYY-MM-DD in the location's timezone
+  temperatureMax: number;
+  temperatureMin: number;
+  precipitationProbability: number;
+  condition: WeatherCondition;
 }
 
-// Define the structure for weather data response
+// Define the structure for weather data
 interface WeatherData {
-  lat: number;
-  lon: number;
+  schemaVersion: number;
+  location: string;
   timezone: string;
-  timezone_offset: number;
+  provider: string;
+  generatedAt: string;
+  units: WeatherUnits;
   current: CurrentWeather;
-  minutely: MinutelyData[];
-  hourly: HourlyWeather[];
   daily: DailyWeather[];
-}
+}
\ No newline at end of file
@@ -11,7 +11,7 @@ import Subway from '@/components/Subway';
 import { useIndex } from '@/hooks/useIndex';
 
 export default function Home() {
-  const { weather, subwayData } = useIndex();
+  const { weather, subwayData, authError } = useIndex();
 
   return (
     <ScrollView contentContainerStyle={styles.scrollContainer}>
@@ -29,6 +29,7 @@ export default function Home() {
         </ThemedView>
 
         <ThemedView style={styles.main}>
+          {authError && <ThemedText type='bold'>{authError}</ThemedText>}
           <Weather data={weather} />
           <Forecast data={weather} />
           <Subway arrivals={subwayData} direction={Direction.North} />
@@ -18,14 +18,15 @@ const Forecast: React.FC<ForecastProps> = ({ data }) => {
 
   const forecast = data?.daily || [];
 
-  const getDayString = (date: number, long: boolean = false): string => {
-    const d = new Date(date * 1000);
+  const getDayString = (date: string, long: boolean = false): string => {
+    // Dates are calendar days in the location's timezone, read them at noon UTC to get the same weekday everywhere
+    const d = new Date(date + 'T12:00:00Z');
     const shortDayNames = ['Sun', 'Mon', 'Tue', 'Wed', 'Thu', 'Fri', 'Sat'];
     const longDayNames = ['Sunday', 'Monday', 'Tuesday', 'Wednesday', 'Thursday', 'Friday', 'Saturday'];
-    return long ? longDayNames[d.getDay()] : shortDayNames[d.getDay()];
+    return long ? longDayNames[d.getUTCDay()] : shortDayNames[d.getUTCDay()];
   };
 
-  const chartData = forecast.map(d => d.temp.day);
+  const chartData = forecast.map(d => d.temperatureMax);
 
   const contentInset = { top: 20, bottom: 20 };
 
@@ -61,11 +62,11 @@ const Forecast: React.FC<ForecastProps> = ({ data }) => {
           <View style={styles.legend}>
             {forecast.map((day, index) => (
               <View key={index} style={styles.forecastDay}>
-                <ThemedText style={[styles.forecastDate]}>{getDayString(day.dt)}</ThemedText>
+                <ThemedText style={[styles.forecastDate]}>{getDayString(day.date)}</ThemedText>
                 <WeatherIcon size={32} weatherData={day} />
                 <View style={styles.forecastTemp}>
-                  <Text style={[styles.day, { color: themeFontColor }]}>{Math.round(day.temp.day)}°</Text>
-                  <Text style={[styles.night, { color: themeFontColorMuted }]}>{Math.round(day.temp.night)}°</Text>
+                  <Text style={[styles.day, { color: themeFontColor }]}>{Math.round(day.temperatureMax)}°</Text>
+                  <Text style={[styles.night, { color: themeFontColorMuted }]}>{Math.round(day.temperatureMin)}°</Text>
                 </View>
               </View>
             ))}
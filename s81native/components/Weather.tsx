@@ -10,15 +10,15 @@ interface WeatherProps {
 
 const Weather: React.FC<WeatherProps> = ({ data }) => {
   const getTemp = (temp: number | undefined) => {
-    if (!temp) return "55 °F";
-    return Math.round(temp) + "°F";
+    if (temp === undefined) return "55 °F";
+    return Math.round(temp) + (data?.units.temperature ?? "°F");
   };
 
   return (
     <Widget>
       <ThemedText type='bold'>Weather</ThemedText>
       <View style={styles.weatherContent}>
-        <ThemedText style={styles.temp}>{getTemp(data?.current?.temp)}</ThemedText>
+        <ThemedText style={styles.temp}>{getTemp(data?.current?.temperature)}</ThemedText>
         <WeatherIcon size={80} weatherData={data?.current} />
       </View>
     </Widget>
@@ -0,0 +1,23 @@
+// Close code the server uses when it closes a connection because the client's token expired
+export const CLOSE_POLICY_VIOLATION = 1008;
+
+// Read the exp claim of a JWT, in seconds since the epoch, without verifying the token
+export const tokenExpiry = (token: string): number | undefined => {
+    const payload = token.split('.')[1];
+    if (!payload) {
+        return undefined;
+    }
+    try {
+        const json = atob(payload.replace(/-/g, '+').replace(/_/g, '/'));
+        const exp = JSON.parse(json).exp;
+        return typeof exp === 'number' ? exp : undefined;
+    } catch {
+        return undefined;
+    }
+};
+
+// Check whether a token has expired, the server rejects the upgrade with 401 once it has
+export const isTokenExpired = (token: string, now: number = Date.now()): boolean => {
+    const exp = tokenExpiry(token);
+    return exp !== undefined && now >= exp * 1000;
+};
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const defaultAdminPort = "8092" // Default port of the internal admin listener
+
+// newAdminServer creates the internal HTTP server for /admin/log-level on ADMIN_PORT, or returns nil if ADMIN_TOKEN
+// is not set. It must not be exposed publicly
+func newAdminServer() *http.Server {
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		return nil
+	}
+	port := os.Getenv("ADMIN_PORT")
+	if port == "" {
+		port = defaultAdminPort
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/log-level", requireToken(token, handleLogLevel))
+	return &http.Server{Addr: ":" + port, Handler: mux}
+}
+
+// requireToken answers 401 to requests that do not present the token as a bearer token
+func requireToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// handleLogLevel reports the log level on GET and changes it on PUT or POST with a level query parameter
+func handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		previous := logLevel.Level()
+		if err := logLevel.UnmarshalText([]byte(r.URL.Query().Get("level"))); err != nil {
+			http.Error(w, "level must be DEBUG, INFO, WARN or ERROR", http.StatusBadRequest)
+			return
+		}
+		slog.Warn("Changed log level", "from", previous.String(), "to", logLevel.Level().String())
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"level": logLevel.Level().String()})
+}
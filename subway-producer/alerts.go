@@ -0,0 +1,140 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	gtfs_realtime "github.com/michael-hauser/s81/subway-producer/gtfs-realtime"
+)
+
+// SubwayAlert is a service alert affecting one or more configured lines
+type SubwayAlert struct {
+	ID              string         `json:"id"`
+	Lines           []string       `json:"lines"`
+	Cause           string         `json:"cause"`
+	Effect          string         `json:"effect"`
+	Severity        string         `json:"severity"`
+	ActivePeriods   []ActivePeriod `json:"activePeriods"`
+	HeaderText      []Translation  `json:"headerText"`
+	DescriptionText []Translation  `json:"descriptionText"`
+}
+
+// ActivePeriod is a time range in which an alert applies, a zero start or end means unbounded
+type ActivePeriod struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// Translation is an alert text in a single language
+type Translation struct {
+	Language string `json:"language"`
+	Text     string `json:"text"`
+}
+
+// AlertsMessage is the payload published to the alerts topic for a station
+type AlertsMessage struct {
+	Station     string        `json:"station"`
+	GeneratedAt int64         `json:"generatedAt"`
+	Alerts      []SubwayAlert `json:"alerts"`
+}
+
+// extractAlerts returns the alerts in the feed whose informed entities match the line's route or stops
+func extractAlerts(feedMessage *gtfs_realtime.FeedMessage, config SubwayConfig) []SubwayAlert {
+	var alerts []SubwayAlert
+
+	for _, entity := range feedMessage.GetEntity() {
+		alert := entity.GetAlert()
+		if alert == nil || !alertMatchesLine(alert, config) {
+			continue
+		}
+		alerts = append(alerts, newSubwayAlert(entity.GetId(), alert, config.Name))
+	}
+
+	return alerts
+}
+
+// alertMatchesLine checks if any informed entity of the alert refers to the line's route or one of its stops
+func alertMatchesLine(alert *gtfs_realtime.Alert, config SubwayConfig) bool {
+	for _, selector := range alert.GetInformedEntity() {
+		if selector.GetRouteId() == config.TripRouteID || selector.GetTrip().GetRouteId() == config.TripRouteID {
+			return true
+		}
+		if selector.GetStopId() != "" && contains(config.Stops, selector.GetStopId()) {
+			return true
+		}
+	}
+	return false
+}
+
+// newSubwayAlert converts a GTFS-realtime alert into the published format
+func newSubwayAlert(id string, alert *gtfs_realtime.Alert, line string) SubwayAlert {
+	activePeriods := []ActivePeriod{}
+	for _, period := range alert.GetActivePeriod() {
+		activePeriods = append(activePeriods, ActivePeriod{
+			Start: int64(period.GetStart()),
+			End:   int64(period.GetEnd()),
+		})
+	}
+
+	return SubwayAlert{
+		ID:              id,
+		Lines:           []string{line},
+		Cause:           alert.GetCause().String(),
+		Effect:          alert.GetEffect().String(),
+		Severity:        alert.GetSeverityLevel().String(),
+		ActivePeriods:   activePeriods,
+		HeaderText:      translations(alert.GetHeaderText()),
+		DescriptionText: translations(alert.GetDescriptionText()),
+	}
+}
+
+// translations flattens a translated string into language and text pairs
+func translations(translated *gtfs_realtime.TranslatedString) []Translation {
+	result := []Translation{}
+	for _, translation := range translated.GetTranslation() {
+		result = append(result, Translation{
+			Language: translation.GetLanguage(),
+			Text:     translation.GetText(),
+		})
+	}
+	return result
+}
+
+// mergeAlerts adds alerts to the list, combining the lines of alerts that share an ID
+func mergeAlerts(alerts []SubwayAlert, added []SubwayAlert) []SubwayAlert {
+	for _, alert := range added {
+		merged := false
+		for i := range alerts {
+			if alerts[i].ID != alert.ID {
+				continue
+			}
+			for _, line := range alert.Lines {
+				if !contains(alerts[i].Lines, line) {
+					alerts[i].Lines = append(alerts[i].Lines, line)
+				}
+			}
+			merged = true
+			break
+		}
+		if !merged {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts
+}
+
+// newAlertsMessage builds the alerts payload for a station, sorted by alert ID
+func newAlertsMessage(station StationConfig, alerts []SubwayAlert, now time.Time) AlertsMessage {
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].ID < alerts[j].ID
+	})
+	if alerts == nil {
+		alerts = []SubwayAlert{}
+	}
+
+	return AlertsMessage{
+		Station:     station.ID,
+		GeneratedAt: now.Unix(),
+		Alerts:      alerts,
+	}
+}
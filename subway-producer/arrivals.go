@@ -0,0 +1,145 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	gtfs_realtime "github.com/michael-hauser/s81/subway-producer/gtfs-realtime"
+)
+
+// maxArrivalsPerDirection is the number of upcoming arrivals kept for each direction of a line
+const maxArrivalsPerDirection = 10
+
+// Arrival is a single normalized train arrival at a configured stop
+type Arrival struct {
+	Line                 string `json:"line"`
+	Direction            string `json:"direction"`
+	StopID               string `json:"stopId"`
+	TripID               string `json:"tripId"`
+	ArrivalTime          int64  `json:"arrivalTime"`
+	Delay                int32  `json:"delay"`
+	ScheduleRelationship string `json:"scheduleRelationship"`
+}
+
+// FeedStatus describes the freshness of the feed a line's arrivals were built from
+type FeedStatus struct {
+	Line          string `json:"line"`
+	Endpoint      string `json:"endpoint"`
+	FeedTimestamp int64  `json:"feedTimestamp"`
+	FetchedAt     int64  `json:"fetchedAt"`
+}
+
+// ArrivalsMessage is the payload published to the arrivals topic. It is the snapshot the arrivals deltas apply to,
+// with the epoch and the sequence number of each line's latest delta.
+type ArrivalsMessage struct {
+	GeneratedAt int64             `json:"generatedAt"`
+	Epoch       int64             `json:"epoch"`
+	Sequences   map[string]uint64 `json:"sequences"`
+	Feeds       []FeedStatus      `json:"feeds"`
+	Arrivals    []Arrival         `json:"arrivals"`
+}
+
+// buildArrivals turns a feed filtered by filterFeedForLine into normalized arrivals for the line. Trains that
+// already left at now are dropped, the rest are sorted by arrival time and limited to the next
+// maxArrivalsPerDirection in each direction.
+func buildArrivals(feedMessage *gtfs_realtime.FeedMessage, config SubwayConfig, now time.Time) []Arrival {
+	var arrivals []Arrival
+
+	for _, entity := range feedMessage.GetEntity() {
+		tripUpdate := entity.GetTripUpdate()
+		if tripUpdate == nil {
+			continue
+		}
+
+		for _, update := range tripUpdate.GetStopTimeUpdate() {
+			event := update.GetArrival()
+			if event.GetTime() == 0 {
+				event = update.GetDeparture()
+			}
+			if event.GetTime() == 0 {
+				continue
+			}
+			// The departure is later than the arrival for trains standing in the station
+			if departure := update.GetDeparture().GetTime(); max(event.GetTime(), departure) <= now.Unix() {
+				continue
+			}
+
+			arrivals = append(arrivals, Arrival{
+				Line:                 config.Name,
+				Direction:            stopDirection(update.GetStopId()),
+				StopID:               update.GetStopId(),
+				TripID:               tripUpdate.GetTrip().GetTripId(),
+				ArrivalTime:          event.GetTime(),
+				Delay:                event.GetDelay(),
+				ScheduleRelationship: update.GetScheduleRelationship().String(),
+			})
+		}
+	}
+
+	sortArrivals(arrivals)
+	return limitPerDirection(arrivals, maxArrivalsPerDirection)
+}
+
+// sortArrivals sorts arrivals by arrival time, then by trip ID so the order does not depend on the feed's
+func sortArrivals(arrivals []Arrival) {
+	sort.SliceStable(arrivals, func(i, j int) bool {
+		if arrivals[i].ArrivalTime != arrivals[j].ArrivalTime {
+			return arrivals[i].ArrivalTime < arrivals[j].ArrivalTime
+		}
+		return arrivals[i].TripID < arrivals[j].TripID
+	})
+}
+
+// limitPerDirection keeps the first limit arrivals of each direction of sorted arrivals
+func limitPerDirection(arrivals []Arrival, limit int) []Arrival {
+	counts := make(map[string]int)
+	kept := arrivals[:0]
+	for _, arrival := range arrivals {
+		if counts[arrival.Direction] < limit {
+			counts[arrival.Direction]++
+			kept = append(kept, arrival)
+		}
+	}
+	return kept
+}
+
+// newFeedStatus records the header timestamp and fetch time of the feed used for a line
+func newFeedStatus(config SubwayConfig, feed *FetchedFeed) FeedStatus {
+	return FeedStatus{
+		Line:          config.Name,
+		Endpoint:      feed.Endpoint,
+		FeedTimestamp: int64(feed.Message.GetHeader().GetTimestamp()),
+		FetchedAt:     feed.FetchedAt.Unix(),
+	}
+}
+
+// newArrivalsMessage builds the arrivals payload, sorted by arrival time
+func newArrivalsMessage(arrivals []Arrival, feeds []FeedStatus, now time.Time) ArrivalsMessage {
+	sortArrivals(arrivals)
+	if arrivals == nil {
+		arrivals = []Arrival{}
+	}
+
+	if feeds == nil {
+		feeds = []FeedStatus{}
+	}
+
+	return ArrivalsMessage{
+		GeneratedAt: now.Unix(),
+		Feeds:       feeds,
+		Arrivals:    arrivals,
+	}
+}
+
+// stopDirection returns the direction of a stop from its N/S suffix
+func stopDirection(stopID string) string {
+	switch {
+	case strings.HasSuffix(stopID, "N"):
+		return "N"
+	case strings.HasSuffix(stopID, "S"):
+		return "S"
+	default:
+		return ""
+	}
+}
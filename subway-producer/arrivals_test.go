@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	gtfs_realtime "github.com/michael-hauser/s81/subway-producer/gtfs-realtime"
+	"google.golang.org/protobuf/proto"
+)
+
+// stopTime is a stop time update of a test trip, a zero time leaves the arrival or departure unset
+type stopTime struct {
+	stop      string
+	arrival   int64
+	departure int64
+}
+
+// tripEntity builds a feed entity for a trip with the given stop time updates
+func tripEntity(tripID string, stopTimes ...stopTime) *gtfs_realtime.FeedEntity {
+	tripUpdate := &gtfs_realtime.TripUpdate{Trip: &gtfs_realtime.TripDescriptor{TripId: proto.String(tripID)}}
+	for _, st := range stopTimes {
+		update := &gtfs_realtime.TripUpdate_StopTimeUpdate{StopId: proto.String(st.stop)}
+		if st.arrival != 0 {
+			update.Arrival = &gtfs_realtime.TripUpdate_StopTimeEvent{Time: proto.Int64(st.arrival)}
+		}
+		if st.departure != 0 {
+			update.Departure = &gtfs_realtime.TripUpdate_StopTimeEvent{Time: proto.Int64(st.departure)}
+		}
+		tripUpdate.StopTimeUpdate = append(tripUpdate.StopTimeUpdate, update)
+	}
+	return &gtfs_realtime.FeedEntity{Id: proto.String(tripID), TripUpdate: tripUpdate}
+}
+
+// arrivalSummary is the direction, trip and time of an arrival
+type arrivalSummary struct {
+	direction string
+	trip      string
+	time      int64
+}
+
+func summarizeArrivals(arrivals []Arrival) []arrivalSummary {
+	var summary []arrivalSummary
+	for _, arrival := range arrivals {
+		summary = append(summary, arrivalSummary{arrival.Direction, arrival.TripID, arrival.ArrivalTime})
+	}
+	return summary
+}
+
+func TestBuildArrivals(t *testing.T) {
+	now := time.Unix(1726574400, 0)
+	at := func(minutes int64) int64 { return now.Unix() + minutes*60 }
+
+	// Twelve northbound trains, two minutes apart, listed latest first
+	var manyNorthbound []*gtfs_realtime.FeedEntity
+	var expectedNorthbound []arrivalSummary
+	for i := 12; i >= 1; i-- {
+		trip := tripEntity(fmt.Sprintf("trip-%02d", i), stopTime{stop: "A21N", arrival: at(int64(2 * i))})
+		manyNorthbound = append(manyNorthbound, trip)
+	}
+	for i := 1; i <= maxArrivalsPerDirection; i++ {
+		expectedNorthbound = append(expectedNorthbound, arrivalSummary{"N", fmt.Sprintf("trip-%02d", i), at(int64(2 * i))})
+	}
+
+	tests := []struct {
+		name     string
+		entities []*gtfs_realtime.FeedEntity
+		expected []arrivalSummary
+	}{
+		{
+			name: "direction split",
+			entities: []*gtfs_realtime.FeedEntity{
+				tripEntity("north", stopTime{stop: "A21N", arrival: at(3)}),
+				tripEntity("south", stopTime{stop: "A21S", arrival: at(4)}),
+			},
+			expected: []arrivalSummary{{"N", "north", at(3)}, {"S", "south", at(4)}},
+		},
+		{
+			name: "sorted by arrival time then trip",
+			entities: []*gtfs_realtime.FeedEntity{
+				tripEntity("c", stopTime{stop: "A21S", arrival: at(9)}),
+				tripEntity("b", stopTime{stop: "A21N", arrival: at(5)}),
+				tripEntity("a", stopTime{stop: "A21S", arrival: at(5)}),
+			},
+			expected: []arrivalSummary{{"S", "a", at(5)}, {"N", "b", at(5)}, {"S", "c", at(9)}},
+		},
+		{
+			name: "past departures are dropped",
+			entities: []*gtfs_realtime.FeedEntity{
+				tripEntity("departed", stopTime{stop: "A21N", arrival: at(-3), departure: at(-2)}),
+				tripEntity("departing now", stopTime{stop: "A21N", arrival: at(-1), departure: at(0)}),
+				tripEntity("in the station", stopTime{stop: "A21N", arrival: at(-1), departure: at(1)}),
+				tripEntity("upcoming", stopTime{stop: "A21N", arrival: at(6)}),
+			},
+			expected: []arrivalSummary{{"N", "in the station", at(-1)}, {"N", "upcoming", at(6)}},
+		},
+		{
+			name:     "limited per direction",
+			entities: append(manyNorthbound, tripEntity("south", stopTime{stop: "A21S", arrival: at(30)})),
+			expected: append(expectedNorthbound, arrivalSummary{"S", "south", at(30)}),
+		},
+		{
+			name: "departure only",
+			entities: []*gtfs_realtime.FeedEntity{
+				tripEntity("origin", stopTime{stop: "A21S", departure: at(7)}),
+			},
+			expected: []arrivalSummary{{"S", "origin", at(7)}},
+		},
+		{
+			name: "missing stop times",
+			entities: []*gtfs_realtime.FeedEntity{
+				tripEntity("no times", stopTime{stop: "A21N"}),
+				tripEntity("no updates"),
+				{Id: proto.String("vehicle"), Vehicle: &gtfs_realtime.VehiclePosition{StopId: proto.String("A21N")}},
+				tripEntity("timed", stopTime{stop: "A21N", arrival: at(2)}),
+			},
+			expected: []arrivalSummary{{"N", "timed", at(2)}},
+		},
+		{
+			name:     "empty feed",
+			entities: nil,
+			expected: nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			feed := &gtfs_realtime.FeedMessage{Entity: test.entities}
+			arrivals := buildArrivals(feed, lineC, now)
+			if got := summarizeArrivals(arrivals); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("got %v, want %v", got, test.expected)
+			}
+			for _, arrival := range arrivals {
+				if arrival.Line != "C" || arrival.ScheduleRelationship != "SCHEDULED" {
+					t.Errorf("arrival %+v does not carry the line and schedule relationship", arrival)
+				}
+			}
+		})
+	}
+}
+
+func TestStopDirection(t *testing.T) {
+	for stop, expected := range map[string]string{"A21N": "N", "A21S": "S", "A21": "", "": ""} {
+		if got := stopDirection(stop); got != expected {
+			t.Errorf("stopDirection(%q) = %q, want %q", stop, got, expected)
+		}
+	}
+}
+
+func TestBuildArrivalsFromFixtures(t *testing.T) {
+	// Two minutes after the fixtures' header timestamp, when the trains due at 81 St in the first two minutes have left
+	now := time.Unix(1726574400+120, 0)
+
+	tests := []struct {
+		fixture string
+		config  SubwayConfig
+		want    []arrivalSummary
+	}{
+		{"synthetic/gtfs-ace.pb", lineA, []arrivalSummary{
+			{"N", "046700_A..N55R", 1726574400 + 330},
+		}},
+		{"synthetic/gtfs-ace.pb", lineC, []arrivalSummary{
+			{"S", "046200_C..S04R", 1726574400 + 780},
+		}},
+		{"synthetic/gtfs-bdfm.pb", lineB, []arrivalSummary{
+			{"N", "046950_D..N08R", 1726574400 + 150},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.fixture+"/"+test.config.Name, func(t *testing.T) {
+			feed := filterFeedForLine(loadFixture(t, test.fixture), test.config)
+			if got := summarizeArrivals(buildArrivals(feed, test.config, now)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"sync/atomic"
+)
+
+// Config holds the stations the producer publishes data for. The websocket-server only delivers the topics in its
+// KAFKA_TOPICS, so topics of stations or lines added here must be added there too.
+type Config struct {
+	AlertsTopic     string          `json:"alertsTopic"` // Shared by all stations, each station's alerts keyed by its ID
+	DeadLetterTopic string          `json:"deadLetterTopic"`
+	Stations        []StationConfig `json:"stations"`
+}
+
+// StationConfig holds the configuration for a single station and the lines that serve it
+type StationConfig struct {
+	ID            string         `json:"id"`
+	Name          string         `json:"name"`
+	ArrivalsTopic string         `json:"arrivalsTopic"`
+	DeltaTopic    string         `json:"deltaTopic"`
+	Lines         []SubwayConfig `json:"lines"`
+}
+
+// SubwayConfig holds the configuration for each train line
+type SubwayConfig struct {
+	Name        string   `json:"name"`
+	Endpoint    string   `json:"endpoint"`
+	TripRouteID string   `json:"tripRouteId"`
+	Stops       []string `json:"stops"`
+	Topic       string   `json:"topic"`
+}
+
+// defaultConfig returns the configuration used when no configuration file or environment variable is set.
+// It covers the A/B/C lines at 81 St-Museum of Natural History. Each call returns new slices, since validate fills
+// in missing topics in place.
+func defaultConfig() Config {
+	return Config{
+		AlertsTopic:     "subway-alerts",
+		DeadLetterTopic: "subway-dead-letter",
+		Stations: []StationConfig{
+			{
+				ID:            "s81",
+				Name:          "81 St-Museum of Natural History",
+				ArrivalsTopic: "arrivals-s81",
+				DeltaTopic:    "arrivals-s81-delta",
+				Lines: []SubwayConfig{
+					{
+						Name:        "A",
+						Endpoint:    "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-ace",
+						TripRouteID: "A",
+						Stops:       []string{"A21N", "A21S"},
+						Topic:       "subway-a",
+					},
+					{
+						Name:        "B",
+						Endpoint:    "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-bdfm",
+						TripRouteID: "D",
+						Stops:       []string{"B21N", "B21S"},
+						Topic:       "subway-b",
+					},
+					{
+						Name:        "C",
+						Endpoint:    "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-ace",
+						TripRouteID: "C",
+						Stops:       []string{"A21N", "A21S"},
+						Topic:       "subway-c",
+					},
+				},
+			},
+		},
+	}
+}
+
+// currentConfig holds the active configuration, swapped atomically on reload
+var currentConfig atomic.Pointer[Config]
+
+// loadConfig reads the configuration from SUBWAY_CONFIG_FILE, then SUBWAY_CONFIG, falling back to the defaults
+func loadConfig() (*Config, error) {
+	var data []byte
+	if path := os.Getenv("SUBWAY_CONFIG_FILE"); path != "" {
+		fileData, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		data = fileData
+	} else if env := os.Getenv("SUBWAY_CONFIG"); env != "" {
+		data = []byte(env)
+	}
+
+	config := defaultConfig()
+	if data != nil {
+		config = Config{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("parsing config: %w", err)
+		}
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// reloadConfig loads the configuration and makes it active, keeping the previous one if it is invalid.
+// It warns about topics the previous configuration did not publish, which clients only receive once they are
+// added to the websocket-server's KAFKA_TOPICS.
+func reloadConfig() error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	previous := currentConfig.Swap(config)
+	if previous != nil {
+		if added := newTopics(previous, config); len(added) > 0 {
+			slog.Warn("Configuration publishes new topics, add them to the websocket-server's KAFKA_TOPICS",
+				"topics", added)
+		}
+	}
+	return nil
+}
+
+// clientTopics returns the topics published for clients: the line, arrivals and delta topics of every station
+// and the alerts topic
+func (c *Config) clientTopics() []string {
+	topics := []string{c.AlertsTopic}
+	for _, station := range c.Stations {
+		topics = append(topics, station.ArrivalsTopic, station.DeltaTopic)
+		for _, line := range station.Lines {
+			topics = append(topics, line.Topic)
+		}
+	}
+	return topics
+}
+
+// newTopics returns the client topics of next that previous does not publish
+func newTopics(previous, next *Config) []string {
+	published := make(map[string]bool)
+	for _, topic := range previous.clientTopics() {
+		published[topic] = true
+	}
+	var added []string
+	for _, topic := range next.clientTopics() {
+		if !published[topic] {
+			published[topic] = true
+			added = append(added, topic)
+		}
+	}
+	return added
+}
+
+// validate checks the configuration for missing fields and duplicate names or topics
+func (c *Config) validate() error {
+	if len(c.Stations) == 0 {
+		return errors.New("config must define at least one station")
+	}
+
+	if c.AlertsTopic == "" {
+		c.AlertsTopic = "subway-alerts"
+	}
+	if c.DeadLetterTopic == "" {
+		c.DeadLetterTopic = "subway-dead-letter"
+	}
+	if c.DeadLetterTopic == c.AlertsTopic {
+		return fmt.Errorf("duplicate topic %s", c.DeadLetterTopic)
+	}
+
+	stationIDs := make(map[string]bool)
+	topics := map[string]bool{c.AlertsTopic: true, c.DeadLetterTopic: true}
+	for i := range c.Stations {
+		station := &c.Stations[i]
+		if station.ID == "" {
+			return fmt.Errorf("station %d: id is required", i)
+		}
+		if stationIDs[station.ID] {
+			return fmt.Errorf("station %s: duplicate id", station.ID)
+		}
+		stationIDs[station.ID] = true
+
+		if station.ArrivalsTopic == "" {
+			station.ArrivalsTopic = "arrivals-" + station.ID
+		}
+		if topics[station.ArrivalsTopic] {
+			return fmt.Errorf("station %s: duplicate topic %s", station.ID, station.ArrivalsTopic)
+		}
+		topics[station.ArrivalsTopic] = true
+
+		if station.DeltaTopic == "" {
+			station.DeltaTopic = station.ArrivalsTopic + "-delta"
+		}
+		if topics[station.DeltaTopic] {
+			return fmt.Errorf("station %s: duplicate topic %s", station.ID, station.DeltaTopic)
+		}
+		topics[station.DeltaTopic] = true
+
+		if len(station.Lines) == 0 {
+			return fmt.Errorf("station %s: at least one line is required", station.ID)
+		}
+		lineNames := make(map[string]bool)
+		for _, line := range station.Lines {
+			if err := line.validate(); err != nil {
+				return fmt.Errorf("station %s: %w", station.ID, err)
+			}
+			if lineNames[line.Name] {
+				return fmt.Errorf("station %s: duplicate line %s", station.ID, line.Name)
+			}
+			lineNames[line.Name] = true
+
+			if topics[line.Topic] {
+				return fmt.Errorf("station %s: duplicate topic %s", station.ID, line.Topic)
+			}
+			topics[line.Topic] = true
+		}
+	}
+	return nil
+}
+
+// validate checks that a line has everything needed to fetch and filter its feed
+func (c SubwayConfig) validate() error {
+	if c.Name == "" {
+		return errors.New("line name is required")
+	}
+	if c.TripRouteID == "" {
+		return fmt.Errorf("line %s: tripRouteId is required", c.Name)
+	}
+	if len(c.Stops) == 0 {
+		return fmt.Errorf("line %s: at least one stop is required", c.Name)
+	}
+	if c.Topic == "" {
+		return fmt.Errorf("line %s: topic is required", c.Name)
+	}
+	endpoint, err := url.Parse(c.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return fmt.Errorf("line %s: invalid endpoint %q", c.Name, c.Endpoint)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// validStation returns a station with one line and every required field
+func validStation(id string) StationConfig {
+	return StationConfig{
+		ID: id,
+		Lines: []SubwayConfig{{
+			Name:        "C",
+			Endpoint:    "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-ace",
+			TripRouteID: "C",
+			Stops:       []string{"A21N", "A21S"},
+			Topic:       "subway-c-" + id,
+		}},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		err    string // Empty if the configuration is valid.
+	}{
+		{"valid", func(c *Config) {}, ""},
+		{"no stations", func(c *Config) { c.Stations = nil }, "at least one station"},
+		{"missing station id", func(c *Config) { c.Stations[0].ID = "" }, "station 0: id is required"},
+		{"duplicate station id", func(c *Config) { c.Stations[1].ID = "s81" }, "station s81: duplicate id"},
+		{"duplicate arrivals topic", func(c *Config) { c.Stations[1].ArrivalsTopic = "arrivals-s81" },
+			"duplicate topic arrivals-s81"},
+		{"delta topic reused as arrivals topic", func(c *Config) { c.Stations[1].ArrivalsTopic = "arrivals-s81-delta" },
+			"duplicate topic arrivals-s81-delta"},
+		{"line topic reused", func(c *Config) { c.Stations[1].Lines[0].Topic = "subway-c-s81" },
+			"duplicate topic subway-c-s81"},
+		{"dead letter topic reused as alerts topic", func(c *Config) { c.DeadLetterTopic = "subway-alerts" },
+			"duplicate topic subway-alerts"},
+		{"no lines", func(c *Config) { c.Stations[0].Lines = nil }, "station s81: at least one line is required"},
+		{"duplicate line", func(c *Config) {
+			line := c.Stations[0].Lines[0]
+			line.Topic = "other"
+			c.Stations[0].Lines = append(c.Stations[0].Lines, line)
+		}, "station s81: duplicate line C"},
+		{"missing line name", func(c *Config) { c.Stations[0].Lines[0].Name = "" }, "line name is required"},
+		{"missing trip route", func(c *Config) { c.Stations[0].Lines[0].TripRouteID = "" }, "tripRouteId is required"},
+		{"missing stops", func(c *Config) { c.Stations[0].Lines[0].Stops = nil }, "at least one stop is required"},
+		{"missing line topic", func(c *Config) { c.Stations[0].Lines[0].Topic = "" }, "topic is required"},
+		{"invalid endpoint", func(c *Config) { c.Stations[0].Lines[0].Endpoint = "mta" }, `invalid endpoint "mta"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := Config{Stations: []StationConfig{validStation("s81"), validStation("s86")}}
+			test.modify(&config)
+			err := config.validate()
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("got %v, want a valid configuration", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("got %v, want an error containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestValidateFillsInTopics(t *testing.T) {
+	config := Config{Stations: []StationConfig{validStation("s81")}}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	station := config.Stations[0]
+	if config.AlertsTopic != "subway-alerts" || config.DeadLetterTopic != "subway-dead-letter" ||
+		station.ArrivalsTopic != "arrivals-s81" || station.DeltaTopic != "arrivals-s81-delta" {
+		t.Fatalf("topics not filled in: %+v", config)
+	}
+}
+
+func TestLoadConfigDoesNotShareDefaults(t *testing.T) {
+	t.Setenv("SUBWAY_CONFIG_FILE", "")
+	t.Setenv("SUBWAY_CONFIG", "")
+
+	first, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Stations[0].ArrivalsTopic = "changed"
+	first.Stations[0].Lines[0].Stops[0] = "changed"
+
+	second, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Stations[0].ArrivalsTopic != "arrivals-s81" || second.Stations[0].Lines[0].Stops[0] != "A21N" {
+		t.Fatalf("changing a loaded configuration changed the defaults: %+v", second.Stations[0])
+	}
+	if defaults := defaultConfig(); !reflect.DeepEqual(*second, defaults) {
+		t.Fatalf("loaded defaults %+v differ from %+v", *second, defaults)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	t.Setenv("SUBWAY_CONFIG_FILE", "")
+	t.Setenv("SUBWAY_CONFIG", "")
+	previous := currentConfig.Load()
+	t.Cleanup(func() { currentConfig.Store(previous) })
+
+	if err := reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	defaults := currentConfig.Load()
+
+	// An invalid configuration keeps the active one
+	t.Setenv("SUBWAY_CONFIG", `{"stations": []}`)
+	if err := reloadConfig(); err == nil {
+		t.Fatal("reloading an invalid configuration succeeded")
+	}
+	if currentConfig.Load() != defaults {
+		t.Fatal("an invalid configuration replaced the active one")
+	}
+
+	t.Setenv("SUBWAY_CONFIG", `{"stations": [{"id": "s86", "lines": [{"name": "C", "tripRouteId": "C",
+		"endpoint": "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-ace",
+		"stops": ["A20N", "A20S"], "topic": "subway-c-s86"}]}]}`)
+	if err := reloadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if station := currentConfig.Load().Stations[0]; station.ID != "s86" || station.ArrivalsTopic != "arrivals-s86" {
+		t.Fatalf("reloaded configuration not active: %+v", station)
+	}
+}
+
+func TestNewTopics(t *testing.T) {
+	previous := defaultConfig()
+	next := defaultConfig()
+	next.Stations = append(next.Stations, validStation("s86"))
+	for _, config := range []*Config{&previous, &next} {
+		if err := config.validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if added := newTopics(&previous, &previous); len(added) != 0 {
+		t.Errorf("got %v for an unchanged configuration, want none", added)
+	}
+	want := []string{"arrivals-s86", "arrivals-s86-delta", "subway-c-s86"}
+	if added := newTopics(&previous, &next); !reflect.DeepEqual(added, want) {
+		t.Errorf("got %v, want %v", added, want)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	maxFeedSize       = 32 << 20 // Largest feed body accepted from the MTA.
+	maxDeadLetterSize = 64 << 10 // Rejected bodies are truncated to this size on the dead-letter topic.
+)
+
+// RejectedPayloadError is returned when an upstream response arrived but is not fit to publish
+type RejectedPayloadError struct {
+	Reason     string
+	StatusCode int
+	Body       []byte
+}
+
+func (e *RejectedPayloadError) Error() string {
+	return "rejected payload: " + e.Reason
+}
+
+// readResponse checks the status code and reads the body up to limit bytes
+func readResponse(res *http.Response, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(res.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading response body: %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, &RejectedPayloadError{
+			Reason:     fmt.Sprintf("unexpected status %d", res.StatusCode),
+			StatusCode: res.StatusCode,
+			Body:       body,
+		}
+	}
+	if int64(len(body)) > limit {
+		return nil, &RejectedPayloadError{
+			Reason:     fmt.Sprintf("body exceeds %d bytes", limit),
+			StatusCode: res.StatusCode,
+			Body:       body,
+		}
+	}
+	return body, nil
+}
+
+// publishDeadLetter publishes a rejected payload to the dead-letter topic, with the reason and source in the headers
+func publishDeadLetter(writer *kafka.Writer, topic string, source string, rejected *RejectedPayloadError) error {
+	body := rejected.Body
+	truncated := len(body) > maxDeadLetterSize
+	if truncated {
+		body = body[:maxDeadLetterSize]
+	}
+
+	return writer.WriteMessages(context.Background(),
+		kafka.Message{
+			Topic: topic,
+			Key:   []byte(source),
+			Value: body,
+			Headers: []kafka.Header{
+				{Key: "reason", Value: []byte(rejected.Reason)},
+				{Key: "source", Value: []byte(source)},
+				{Key: "status-code", Value: []byte(strconv.Itoa(rejected.StatusCode))},
+				{Key: "truncated", Value: []byte(strconv.FormatBool(truncated))},
+				{Key: "rejected-at", Value: []byte(time.Now().UTC().Format(time.RFC3339))},
+			},
+		},
+	)
+}
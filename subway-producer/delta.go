@@ -0,0 +1,138 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JSON-patch operations used in arrivals deltas
+const (
+	OpAdd     = "add"
+	OpRemove  = "remove"
+	OpReplace = "replace"
+)
+
+// ArrivalOp is a JSON-patch-style operation on a line's arrivals, which are addressed as /arrivals/{tripId}:{stopId}
+type ArrivalOp struct {
+	Op    string   `json:"op"`
+	Path  string   `json:"path"`
+	Value *Arrival `json:"value,omitempty"`
+}
+
+// ArrivalsDelta is published to a station's delta topic when a line's arrivals change. Sequence numbers count up
+// by one per delta of a line and restart when the epoch changes, so a client that misses one can request a snapshot.
+type ArrivalsDelta struct {
+	Station     string      `json:"station"`
+	Line        string      `json:"line"`
+	Epoch       int64       `json:"epoch"`
+	Sequence    uint64      `json:"sequence"`
+	GeneratedAt int64       `json:"generatedAt"`
+	Ops         []ArrivalOp `json:"ops"`
+}
+
+// lineSnapshot is the last published arrivals of a line, keyed by path
+type lineSnapshot struct {
+	sequence uint64
+	arrivals map[string]Arrival
+}
+
+// DeltaTracker remembers the last published arrivals of every line, so only the changes are published as deltas
+type DeltaTracker struct {
+	epoch int64 // Start time of the producer in Unix milliseconds
+
+	mu    sync.Mutex
+	lines map[string]*lineSnapshot // Keyed by station ID and line name
+}
+
+// newDeltaTracker creates a tracker whose sequence numbers belong to an epoch starting at the given time
+func newDeltaTracker(start time.Time) *DeltaTracker {
+	return &DeltaTracker{epoch: start.UnixMilli(), lines: make(map[string]*lineSnapshot)}
+}
+
+// update compares a line's arrivals with the previous ones and returns the delta, or nil if nothing changed.
+// The arrivals become the line's snapshot and the sequence number is advanced for every delta returned.
+func (t *DeltaTracker) update(station string, line string, arrivals []Arrival, now time.Time) *ArrivalsDelta {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	current := make(map[string]Arrival, len(arrivals))
+	for _, arrival := range arrivals {
+		current[arrivalPath(arrival)] = arrival
+	}
+
+	key := deltaKey(station, line)
+	previous, ok := t.lines[key]
+	if !ok {
+		previous = &lineSnapshot{arrivals: map[string]Arrival{}}
+		t.lines[key] = previous
+	}
+
+	ops := diffArrivals(previous.arrivals, current)
+	previous.arrivals = current
+	if len(ops) == 0 {
+		return nil
+	}
+
+	previous.sequence++
+	return &ArrivalsDelta{
+		Station:     station,
+		Line:        line,
+		Epoch:       t.epoch,
+		Sequence:    previous.sequence,
+		GeneratedAt: now.Unix(),
+		Ops:         ops,
+	}
+}
+
+// sequences returns the current sequence number of each line of a station
+func (t *DeltaTracker) sequences(station StationConfig) map[string]uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sequences := make(map[string]uint64, len(station.Lines))
+	for _, line := range station.Lines {
+		if snapshot, ok := t.lines[deltaKey(station.ID, line.Name)]; ok {
+			sequences[line.Name] = snapshot.sequence
+		} else {
+			sequences[line.Name] = 0
+		}
+	}
+	return sequences
+}
+
+// diffArrivals returns the operations turning the previous arrivals into the current ones, ordered by path
+func diffArrivals(previous map[string]Arrival, current map[string]Arrival) []ArrivalOp {
+	var ops []ArrivalOp
+	for path, arrival := range current {
+		arrival := arrival
+		old, ok := previous[path]
+		switch {
+		case !ok:
+			ops = append(ops, ArrivalOp{Op: OpAdd, Path: path, Value: &arrival})
+		case old != arrival:
+			ops = append(ops, ArrivalOp{Op: OpReplace, Path: path, Value: &arrival})
+		}
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			ops = append(ops, ArrivalOp{Op: OpRemove, Path: path})
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool {
+		return ops[i].Path < ops[j].Path
+	})
+	return ops
+}
+
+// arrivalPath returns the JSON pointer of an arrival, escaping the trip and stop IDs as RFC 6901 requires
+func arrivalPath(arrival Arrival) string {
+	escaper := strings.NewReplacer("~", "~0", "/", "~1")
+	return "/arrivals/" + escaper.Replace(arrival.TripID+":"+arrival.StopID)
+}
+
+// deltaKey identifies a line of a station, it is also the Kafka key of the line's deltas
+func deltaKey(station string, line string) string {
+	return station + "/" + line
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeltaTrackerUpdate(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tracker := newDeltaTracker(now)
+
+	first := Arrival{Line: "A", Direction: "N", StopID: "A21N", TripID: "097550_A..N", ArrivalTime: 1700000300}
+	second := Arrival{Line: "A", Direction: "S", StopID: "A21S", TripID: "098000_A..S", ArrivalTime: 1700000600}
+
+	delta := tracker.update("s81", "A", []Arrival{first, second}, now)
+	if delta == nil {
+		t.Fatal("expected a delta for the first arrivals")
+	}
+	if delta.Sequence != 1 || delta.Epoch != now.UnixMilli() {
+		t.Errorf("got sequence %d epoch %d, want 1 and %d", delta.Sequence, delta.Epoch, now.UnixMilli())
+	}
+	if len(delta.Ops) != 2 || delta.Ops[0].Op != OpAdd || delta.Ops[1].Op != OpAdd {
+		t.Errorf("expected two adds, got %+v", delta.Ops)
+	}
+
+	if delta := tracker.update("s81", "A", []Arrival{second, first}, now); delta != nil {
+		t.Errorf("expected no delta for unchanged arrivals, got %+v", delta)
+	}
+
+	delayed := second
+	delayed.ArrivalTime += 60
+	delayed.Delay = 60
+	third := Arrival{Line: "A", Direction: "N", StopID: "A21N", TripID: "099100_A..N", ArrivalTime: 1700000900}
+
+	delta = tracker.update("s81", "A", []Arrival{delayed, third}, now)
+	want := []ArrivalOp{
+		{Op: OpRemove, Path: "/arrivals/097550_A..N:A21N"},
+		{Op: OpReplace, Path: "/arrivals/098000_A..S:A21S", Value: &delayed},
+		{Op: OpAdd, Path: "/arrivals/099100_A..N:A21N", Value: &third},
+	}
+	if delta == nil || delta.Sequence != 2 {
+		t.Fatalf("expected a delta with sequence 2, got %+v", delta)
+	}
+	if !reflect.DeepEqual(delta.Ops, want) {
+		t.Errorf("got ops %+v, want %+v", delta.Ops, want)
+	}
+
+	station := StationConfig{ID: "s81", Lines: []SubwayConfig{lineA, lineB}}
+	if got := tracker.sequences(station); !reflect.DeepEqual(got, map[string]uint64{"A": 2, "B": 0}) {
+		t.Errorf("got sequences %v", got)
+	}
+}
+
+func TestArrivalPath(t *testing.T) {
+	arrival := Arrival{TripID: "trip/1~a", StopID: "A21N"}
+	if got, want := arrivalPath(arrival), "/arrivals/trip~11~0a:A21N"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
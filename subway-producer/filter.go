@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log/slog"
+
+	gtfs_realtime "github.com/michael-hauser/s81/subway-producer/gtfs-realtime"
+	"google.golang.org/protobuf/proto"
+)
+
+// filterFeedForLine returns a new feed message with the entities relevant to a specific train line.
+// The input feed is never modified, matching entities are cloned before their stop time updates are filtered,
+// so a decoded feed can be shared by every line that uses it.
+func filterFeedForLine(feedMessage *gtfs_realtime.FeedMessage, config SubwayConfig) *gtfs_realtime.FeedMessage {
+	var filteredEntities []*gtfs_realtime.FeedEntity
+
+	for _, entity := range feedMessage.GetEntity() {
+		if filtered := filterEntity(entity, config); filtered != nil {
+			filteredEntities = append(filteredEntities, filtered)
+		}
+	}
+
+	// Log the number of entities filtered for the line
+	slog.Debug("Filtered feed", "line", config.Name, "entities", len(filteredEntities))
+
+	// Carry the header through so consumers can tell how fresh the data is
+	var header *gtfs_realtime.FeedHeader
+	if feedMessage.GetHeader() != nil {
+		header = proto.Clone(feedMessage.GetHeader()).(*gtfs_realtime.FeedHeader)
+	}
+
+	return &gtfs_realtime.FeedMessage{Header: header, Entity: filteredEntities}
+}
+
+// filterEntity returns a filtered clone of the entity if it concerns the line at one of its stops, or nil
+func filterEntity(entity *gtfs_realtime.FeedEntity, config SubwayConfig) *gtfs_realtime.FeedEntity {
+	if tripUpdate := entity.GetTripUpdate(); tripUpdate != nil {
+		if tripUpdate.GetTrip().GetRouteId() != config.TripRouteID {
+			return nil
+		}
+		if len(filterStopTimeUpdates(tripUpdate.GetStopTimeUpdate(), config.Stops)) == 0 {
+			return nil
+		}
+
+		clone := proto.Clone(entity).(*gtfs_realtime.FeedEntity)
+		clone.TripUpdate.StopTimeUpdate = filterStopTimeUpdates(clone.TripUpdate.StopTimeUpdate, config.Stops)
+		return clone
+	}
+
+	if vehicle := entity.GetVehicle(); vehicle != nil {
+		if !contains(config.Stops, vehicle.GetStopId()) {
+			return nil
+		}
+		// Vehicles without a route are kept, as long as they are at one of the stops
+		if routeId := vehicle.GetTrip().GetRouteId(); routeId != "" && routeId != config.TripRouteID {
+			return nil
+		}
+		return proto.Clone(entity).(*gtfs_realtime.FeedEntity)
+	}
+
+	return nil
+}
+
+// filterStopTimeUpdates filters the stop time updates for relevant stops
+func filterStopTimeUpdates(updates []*gtfs_realtime.TripUpdate_StopTimeUpdate, relevantStops []string) []*gtfs_realtime.TripUpdate_StopTimeUpdate {
+	var filtered []*gtfs_realtime.TripUpdate_StopTimeUpdate
+	for _, update := range updates {
+		if update.StopId != nil {
+			stopId := *update.StopId
+			if contains(relevantStops, stopId) {
+				filtered = append(filtered, update)
+			}
+		}
+	}
+	return filtered
+}
+
+// contains checks if a slice contains a specific item
+func contains(slice []string, item string) bool {
+	for _, s := range slice {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
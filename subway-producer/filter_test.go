@@ -0,0 +1,173 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	gtfs_realtime "github.com/michael-hauser/s81/subway-producer/gtfs-realtime"
+	"google.golang.org/protobuf/proto"
+)
+
+// Lines as configured for 81 St-Museum of Natural History
+var (
+	lineA = SubwayConfig{Name: "A", TripRouteID: "A", Stops: []string{"A21N", "A21S"}, Topic: "subway-a"}
+	lineB = SubwayConfig{Name: "B", TripRouteID: "D", Stops: []string{"B21N", "B21S"}, Topic: "subway-b"}
+	lineC = SubwayConfig{Name: "C", TripRouteID: "C", Stops: []string{"A21N", "A21S"}, Topic: "subway-c"}
+)
+
+// loadFixture decodes a GTFS-realtime feed from testdata
+func loadFixture(t *testing.T, name string) *gtfs_realtime.FeedMessage {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("reading fixture %s: %v", name, err)
+	}
+	feedMessage := &gtfs_realtime.FeedMessage{}
+	if err := proto.Unmarshal(data, feedMessage); err != nil {
+		t.Fatalf("unmarshalling fixture %s: %v", name, err)
+	}
+	return feedMessage
+}
+
+// summarize maps each entity ID to the stops it references
+func summarize(feedMessage *gtfs_realtime.FeedMessage) map[string][]string {
+	summary := make(map[string][]string)
+	for _, entity := range feedMessage.GetEntity() {
+		var stops []string
+		for _, update := range entity.GetTripUpdate().GetStopTimeUpdate() {
+			stops = append(stops, update.GetStopId())
+		}
+		if vehicle := entity.GetVehicle(); vehicle != nil {
+			stops = append(stops, vehicle.GetStopId())
+		}
+		summary[entity.GetId()] = stops
+	}
+	return summary
+}
+
+func TestFilterFeedForLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		feed   *gtfs_realtime.FeedMessage
+		config SubwayConfig
+		want   map[string][]string
+	}{
+		{
+			name:   "A line keeps only 81 St stops of multi-stop trips and vehicles at 81 St",
+			feed:   loadFixture(t, "synthetic/gtfs-ace.pb"),
+			config: lineA,
+			want: map[string][]string{
+				"000001A": {"A21N"},
+				"000003A": {"A21S"},
+				"000004A": {"A21S"},
+			},
+		},
+		{
+			name:   "C line shares the ACE feed with the A line",
+			feed:   loadFixture(t, "synthetic/gtfs-ace.pb"),
+			config: lineC,
+			want: map[string][]string{
+				"000006C": {"A21N"},
+				"000008C": {"A21S"},
+			},
+		},
+		{
+			name:   "B line matches the D route ID",
+			feed:   loadFixture(t, "synthetic/gtfs-bdfm.pb"),
+			config: lineB,
+			want: map[string][]string{
+				"000001D": {"B21N"},
+				"000004D": {"B21S"},
+			},
+		},
+		{
+			name:   "no entities for stops outside the feed",
+			feed:   loadFixture(t, "synthetic/gtfs-bdfm.pb"),
+			config: lineA,
+			want:   map[string][]string{},
+		},
+		{
+			name: "VehiclePosition-only entity without a trip",
+			feed: &gtfs_realtime.FeedMessage{Entity: []*gtfs_realtime.FeedEntity{
+				{Id: proto.String("v1"), Vehicle: &gtfs_realtime.VehiclePosition{StopId: proto.String("A21N")}},
+				{Id: proto.String("v2"), Vehicle: &gtfs_realtime.VehiclePosition{}},
+			}},
+			config: lineA,
+			want:   map[string][]string{"v1": {"A21N"}},
+		},
+		{
+			name: "trip update without a route ID or trip",
+			feed: &gtfs_realtime.FeedMessage{Entity: []*gtfs_realtime.FeedEntity{
+				{Id: proto.String("t1"), TripUpdate: &gtfs_realtime.TripUpdate{
+					Trip:           &gtfs_realtime.TripDescriptor{TripId: proto.String("t1")},
+					StopTimeUpdate: []*gtfs_realtime.TripUpdate_StopTimeUpdate{{StopId: proto.String("A21N")}},
+				}},
+				{Id: proto.String("t2"), TripUpdate: &gtfs_realtime.TripUpdate{
+					StopTimeUpdate: []*gtfs_realtime.TripUpdate_StopTimeUpdate{{StopId: proto.String("A21N")}},
+				}},
+			}},
+			config: lineA,
+			want:   map[string][]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := summarize(filterFeedForLine(tt.feed, tt.config))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterFeedForLine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterFeedForLineKeepsHeaderAndDoesNotMutateFeed(t *testing.T) {
+	feedMessage := loadFixture(t, "synthetic/gtfs-ace.pb")
+	original := proto.Clone(feedMessage).(*gtfs_realtime.FeedMessage)
+
+	for _, config := range []SubwayConfig{lineA, lineC} {
+		filtered := filterFeedForLine(feedMessage, config)
+		if !proto.Equal(filtered.GetHeader(), original.GetHeader()) {
+			t.Errorf("filterFeedForLine() header = %v, want %v", filtered.GetHeader(), original.GetHeader())
+		}
+
+		// Changing the output must not reach back into the shared feed
+		for _, entity := range filtered.GetEntity() {
+			if tripUpdate := entity.GetTripUpdate(); tripUpdate != nil {
+				tripUpdate.StopTimeUpdate[0].StopId = proto.String("changed")
+			}
+		}
+	}
+
+	if !proto.Equal(feedMessage, original) {
+		t.Error("filterFeedForLine modified the input feed")
+	}
+}
+
+func TestFilterFeedForLineKeepsNyctExtensions(t *testing.T) {
+	feedMessage := loadFixture(t, "synthetic/gtfs-ace.pb")
+	if len(feedMessage.GetHeader().ProtoReflect().GetUnknown()) == 0 {
+		t.Fatal("fixture header has no NYCT extension")
+	}
+
+	filtered := filterFeedForLine(feedMessage, lineA)
+	if len(filtered.GetHeader().ProtoReflect().GetUnknown()) == 0 {
+		t.Error("filtered header lost the NYCT feed header")
+	}
+	for _, entity := range filtered.GetEntity() {
+		tripUpdate := entity.GetTripUpdate()
+		if tripUpdate == nil {
+			continue
+		}
+		if len(tripUpdate.GetTrip().ProtoReflect().GetUnknown()) == 0 {
+			t.Errorf("%s lost the NYCT trip descriptor", entity.GetId())
+		}
+		for _, update := range tripUpdate.GetStopTimeUpdate() {
+			if len(update.ProtoReflect().GetUnknown()) == 0 {
+				t.Errorf("%s lost the NYCT stop time update of %s", entity.GetId(), update.GetStopId())
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	defaultHealthPort = "8082"          // Default port serving /healthz and /readyz
+	defaultMaxAge     = 2 * time.Minute // Default age after which the last fetch or publish makes the producer not ready
+	kafkaCheckTimeout = 2 * time.Second // Time allowed for the Kafka check of /readyz
+)
+
+// ReadinessConfig holds the thresholds /readyz checks the producer against
+type ReadinessConfig struct {
+	MaxAge time.Duration // A feed fetched or a station published longer ago than this is not ready
+}
+
+// loadReadinessConfig reads the readiness thresholds from READY_MAX_AGE
+func loadReadinessConfig() (ReadinessConfig, error) {
+	config := ReadinessConfig{MaxAge: defaultMaxAge}
+	if env := os.Getenv("READY_MAX_AGE"); env != "" {
+		maxAge, err := time.ParseDuration(env)
+		if err != nil || maxAge <= 0 {
+			return config, fmt.Errorf("READY_MAX_AGE must be a positive duration, got %q", env)
+		}
+		config.MaxAge = maxAge
+	}
+	return config, nil
+}
+
+// HealthTracker records the last successful feed fetches and arrivals publishes
+type HealthTracker struct {
+	mu        sync.Mutex
+	fetches   map[string]time.Time // By feed endpoint
+	publishes map[string]time.Time // By station ID
+}
+
+var health = &HealthTracker{
+	fetches:   make(map[string]time.Time),
+	publishes: make(map[string]time.Time),
+}
+
+// fetched records a successful fetch of a feed endpoint
+func (h *HealthTracker) fetched(endpoint string, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fetches[endpoint] = at
+}
+
+// published records a successful arrivals publish for a station
+func (h *HealthTracker) published(station string, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.publishes[station] = at
+}
+
+// check returns why the feeds or stations of the configuration are not ready, by check name
+func (h *HealthTracker) check(config *Config, readiness ReadinessConfig, now time.Time) map[string]error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	checks := make(map[string]error)
+	for _, endpoint := range feedEndpoints(config) {
+		checks["fetch:"+endpoint] = checkAge(h.fetches[endpoint], readiness.MaxAge, now, "fetched")
+	}
+	for _, station := range config.Stations {
+		checks["publish:"+station.ID] = checkAge(h.publishes[station.ID], readiness.MaxAge, now, "published")
+	}
+	return checks
+}
+
+// checkAge returns an error if last is zero or older than maxAge
+func checkAge(last time.Time, maxAge time.Duration, now time.Time, action string) error {
+	if last.IsZero() {
+		return fmt.Errorf("not %s yet", action)
+	}
+	if age := now.Sub(last); age > maxAge {
+		return fmt.Errorf("last %s %s ago", action, age.Round(time.Second))
+	}
+	return nil
+}
+
+// checkKafka connects to the broker and reads its metadata
+func checkKafka(ctx context.Context, kafkaURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, kafkaCheckTimeout)
+	defer cancel()
+
+	conn, err := kafka.DialContext(ctx, "tcp", kafkaURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(kafkaCheckTimeout))
+
+	brokers, err := conn.Brokers()
+	if err != nil {
+		return err
+	}
+	if len(brokers) == 0 {
+		return errors.New("no brokers available")
+	}
+	return nil
+}
+
+// healthResponse is the body of /healthz and /readyz, checks maps each check to "ok" or the reason it failed
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// newHealthServer creates the HTTP server for /healthz and /readyz on HEALTH_PORT
+func newHealthServer(kafkaURL string, readiness ReadinessConfig) *http.Server {
+	port := os.Getenv("HEALTH_PORT")
+	if port == "" {
+		port = defaultHealthPort
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		checks := health.check(currentConfig.Load(), readiness, time.Now())
+		checks["kafka"] = checkKafka(r.Context(), kafkaURL)
+
+		response := healthResponse{Status: "ready", Checks: make(map[string]string)}
+		status := http.StatusOK
+		for name, err := range checks {
+			if err != nil {
+				response.Status = "not ready"
+				response.Checks[name] = err.Error()
+				status = http.StatusServiceUnavailable
+				continue
+			}
+			response.Checks[name] = "ok"
+		}
+		writeHealth(w, status, response)
+	})
+	return &http.Server{Addr: ":" + port, Handler: mux}
+}
+
+// writeHealth writes a health response as JSON
+func writeHealth(w http.ResponseWriter, status int, response healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Error writing health response", "error", err)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthTrackerCheck(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	readiness := ReadinessConfig{MaxAge: 2 * time.Minute}
+	config := &Config{Stations: []StationConfig{
+		{ID: "s81", Lines: []SubwayConfig{{Name: "A", Endpoint: "http://feeds/ace"}, {Name: "B", Endpoint: "http://feeds/bdfm"}}},
+	}}
+
+	tracker := &HealthTracker{fetches: make(map[string]time.Time), publishes: make(map[string]time.Time)}
+	checks := tracker.check(config, readiness, now)
+	if len(checks) != 3 {
+		t.Fatalf("expected checks for two feeds and one station, got %v", checks)
+	}
+	for name, err := range checks {
+		if err == nil {
+			t.Errorf("%s: expected not ready before the first fetch and publish", name)
+		}
+	}
+
+	tracker.fetched("http://feeds/ace", now.Add(-30*time.Second))
+	tracker.fetched("http://feeds/bdfm", now.Add(-3*time.Minute))
+	tracker.published("s81", now.Add(-30*time.Second))
+	checks = tracker.check(config, readiness, now)
+	if err := checks["fetch:http://feeds/ace"]; err != nil {
+		t.Errorf("expected a recent fetch to be ready, got %v", err)
+	}
+	if err := checks["publish:s81"]; err != nil {
+		t.Errorf("expected a recent publish to be ready, got %v", err)
+	}
+	if err := checks["fetch:http://feeds/bdfm"]; err == nil || err.Error() != "last fetched 3m0s ago" {
+		t.Errorf("expected a stale fetch to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const serviceName = "subway-producer" // Value of the service field of every log record
+
+// logLevel is the minimum level logged, changed at runtime through /admin/log-level on the admin listener
+var logLevel = new(slog.LevelVar)
+
+// sensitiveKeys are log attribute keys whose values are never logged. The MTA feeds need no API key, the
+// admin token is the only secret
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+}
+
+// bearerPattern matches bearer credentials embedded in log messages and errors
+var bearerPattern = regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+
+// setupLogging makes the default logger write JSON records at the level in LOG_LEVEL, INFO if unset
+func setupLogging() error {
+	if env := os.Getenv("LOG_LEVEL"); env != "" {
+		if err := logLevel.UnmarshalText([]byte(env)); err != nil {
+			return fmt.Errorf("LOG_LEVEL must be DEBUG, INFO, WARN or ERROR, got %q", env)
+		}
+	}
+	slog.SetDefault(slog.New(newLogHandler(os.Stdout, logLevel)))
+	return nil
+}
+
+// newLogHandler creates a JSON handler that tags records with the service and redacts secrets
+func newLogHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr})
+	return handler.WithAttrs([]slog.Attr{slog.String("service", serviceName)})
+}
+
+// redactAttr hides the values of sensitive keys and the secrets inside strings and errors
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, "[REDACTED]")
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, redact(err.Error()))
+		}
+	}
+	return a
+}
+
+// redact replaces bearer credentials
+func redact(s string) string {
+	return bearerPattern.ReplaceAllString(s, "${1}[REDACTED]")
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -3,50 +3,27 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"io"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 	"time"
 
 	gtfs_realtime "github.com/michael-hauser/s81/subway-producer/gtfs-realtime"
+	"github.com/michael-hauser/s81/telemetry"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/protobuf/proto"
 )
 
-// SubwayConfig holds the configuration for each train line
-type SubwayConfig struct {
-	Name        string
-	Endpoint    string
-	TripRouteID string
-	Stops       []string
-	Topic       string
-}
-
-// Global configuration for all train lines
-var trainConfigs = map[string]SubwayConfig{
-	"A": {
-		Name:        "A",
-		Endpoint:    "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-ace",
-		TripRouteID: "A",
-		Stops:       []string{"A21N", "A21S"},
-		Topic:       "subway-a",
-	},
-	"B": {
-		Name:        "B",
-		Endpoint:    "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-bdfm",
-		TripRouteID: "D",
-		Stops:       []string{"B21N", "B21S"},
-		Topic:       "subway-b",
-	},
-	"C": {
-		Name:        "C",
-		Endpoint:    "https://api-endpoint.mta.info/Dataservice/mtagtfsfeeds/nyct%2Fgtfs-ace",
-		TripRouteID: "C",
-		Stops:       []string{"A21N", "A21S"},
-		Topic:       "subway-c",
-	},
-}
+// defaultShutdownTimeout is the deadline after a shutdown signal for publishing, closing the Kafka writer and
+// flushing traces together, below the 10 seconds Docker waits before killing
+const defaultShutdownTimeout = 8 * time.Second
 
 // Main function
 func main() {
@@ -55,136 +32,384 @@ func main() {
 		kafkaURL = "localhost:9093"
 	}
 
-	// Create Kafka writers for each train line
-	writers := make(map[string]*kafka.Writer)
-	for _, config := range trainConfigs {
-		writers[config.Name] = kafka.NewWriter(kafka.WriterConfig{
-			Brokers: []string{kafkaURL},
-			Topic:   config.Topic,
-		})
-		defer writers[config.Name].Close()
+	if err := setupLogging(); err != nil {
+		fatal("Invalid logging configuration", "error", err)
+	}
+
+	// Load and validate the station configuration
+	if err := reloadConfig(); err != nil {
+		fatal("Invalid subway configuration", "error", err)
+	}
+	shutdownTimeout, err := loadShutdownTimeout()
+	if err != nil {
+		fatal("Invalid shutdown configuration", "error", err)
+	}
+	readiness, err := loadReadinessConfig()
+	if err != nil {
+		fatal("Invalid readiness configuration", "error", err)
+	}
+
+	// Cancel the root context on SIGTERM or SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	shutdownTracing, err := telemetry.Setup(ctx, serviceName)
+	if err != nil {
+		fatal("Invalid tracing configuration", "error", err)
 	}
 
+	// Reload the configuration on SIGHUP
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := reloadConfig(); err != nil {
+				slog.Error("Error reloading subway configuration, keeping previous", "error", err)
+				continue
+			}
+			slog.Info("Reloaded subway configuration")
+		}
+	}()
+
+	// Create a Kafka writer shared by all topics, each message names its own topic
+	writer := kafka.NewWriter(kafka.WriterConfig{
+		Brokers: []string{kafkaURL},
+	})
+
+	// Track the published arrivals of each line to publish deltas
+	deltas := newDeltaTracker(time.Now())
+
 	// Set the interval for fetching data
 	interval := 30 * time.Second
 
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	done := make(chan struct{})
 	go func() {
-		for range ticker.C {
-			fetchAndPublishSubwayData(writers)
-			log.Println("Fetched and published subway data")
+		defer close(done)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fetchAndPublishSubwayData(ctx, writer, deltas, currentConfig.Load())
+				slog.Info("Fetched and published subway data")
+			}
 		}
 	}()
 
-	log.Println("Subway data producer started")
+	// Serve /healthz and /readyz
+	healthServer := newHealthServer(kafkaURL, readiness)
+	go func() {
+		if err := healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("Failed to start health server", "error", err)
+		}
+	}()
+
+	// Serve the admin endpoints on their own internal listener, only when a token protects them
+	adminServer := newAdminServer()
+	if adminServer != nil {
+		go func() {
+			slog.Info("Admin server starting", "addr", adminServer.Addr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("Failed to start admin server", "error", err)
+			}
+		}()
+	} else {
+		slog.Info("ADMIN_TOKEN is not set, admin endpoints are disabled")
+	}
 
-	select {}
+	slog.Info("Subway data producer started", "interval", interval.String())
+
+	// Let the current fetch finish publishing, then flush the writer
+	<-ctx.Done()
+	slog.Info("Shutting down", "deadline", shutdownTimeout.String())
+	drainCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	select {
+	case <-done:
+	case <-drainCtx.Done():
+		slog.Warn("Shutdown deadline reached before publishing finished")
+	}
+	if err := healthServer.Close(); err != nil {
+		slog.Error("Error closing health server", "error", err)
+	}
+	if adminServer != nil {
+		adminServer.Close()
+	}
+	if err := closeWriter(drainCtx, writer); err != nil {
+		slog.Error("Error closing Kafka writer", "error", err)
+	}
+	if err := shutdownTracing(drainCtx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+	slog.Info("Subway data producer stopped")
+}
+
+// loadShutdownTimeout reads the drain deadline from SHUTDOWN_TIMEOUT
+func loadShutdownTimeout() (time.Duration, error) {
+	env := os.Getenv("SHUTDOWN_TIMEOUT")
+	if env == "" {
+		return defaultShutdownTimeout, nil
+	}
+	timeout, err := time.ParseDuration(env)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("SHUTDOWN_TIMEOUT must be a positive duration, got %q", env)
+	}
+	return timeout, nil
+}
+
+// closeWriter flushes and closes the Kafka writer, giving up when ctx is done. The writer has no deadline of its
+// own and blocks while the brokers are unreachable
+func closeWriter(ctx context.Context, writer *kafka.Writer) error {
+	closed := make(chan error, 1)
+	go func() {
+		closed <- writer.Close()
+	}()
+	select {
+	case err := <-closed:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("flushing pending messages: %w", ctx.Err())
+	}
 }
 
-// fetchAndPublishSubwayData fetches the subway data for each line and publishes it to Kafka
-func fetchAndPublishSubwayData(writers map[string]*kafka.Writer) {
+// fetchAndPublishSubwayData fetches each feed endpoint once and publishes the subway data for each station to Kafka.
+// Canceling ctx aborts the fetches, stations whose feeds were not fetched are not published.
+// Each run starts a trace, carried to the consumers in the headers of the published messages.
+func fetchAndPublishSubwayData(ctx context.Context, writer *kafka.Writer, deltas *DeltaTracker, config *Config) {
+	ctx, span := tracer.Start(ctx, "fetchAndPublishSubwayData")
+	defer span.End()
+
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
 
-	for _, config := range trainConfigs {
-		res, err := client.Get(config.Endpoint)
-		if err != nil {
-			log.Printf("Error fetching data for %s: %v", config.Name, err)
-			continue
-		}
+	feeds := fetchFeeds(ctx, client, writer, config.DeadLetterTopic, feedEndpoints(config))
 
-		body, err := io.ReadAll(res.Body)
-		if err != nil {
-			log.Printf("Error reading response body for %s: %v", config.Name, err)
-			res.Body.Close()
-			continue
-		}
-		res.Body.Close()
-
-		feedMessage := &gtfs_realtime.FeedMessage{}
-		err = proto.Unmarshal(body, feedMessage)
-		if err != nil {
-			log.Printf("Error unmarshalling feed for %s: %v", config.Name, err)
-			continue
-		}
+	for _, station := range config.Stations {
+		publishStation(ctx, writer, config.AlertsTopic, deltas, station, feeds)
+	}
+}
 
-		filteredFeed := filterFeedForLine(feedMessage, config)
-		if err := publishToKafka(writers[config.Name], config.Name, filteredFeed); err != nil {
-			log.Printf("Error writing %s message to Kafka: %v", config.Name, err)
+// feedEndpoints returns the distinct feed endpoints used by the configured lines
+func feedEndpoints(config *Config) []string {
+	var endpoints []string
+	for _, station := range config.Stations {
+		for _, line := range station.Lines {
+			if !contains(endpoints, line.Endpoint) {
+				endpoints = append(endpoints, line.Endpoint)
+			}
 		}
 	}
+	return endpoints
 }
 
-// filterFeedForLine filters the feed message for a specific train line
-func filterFeedForLine(feedMessage *gtfs_realtime.FeedMessage, config SubwayConfig) *gtfs_realtime.FeedMessage {
-	var filteredEntities []*gtfs_realtime.FeedEntity
+// FetchedFeed is a decoded feed along with where and when it was fetched
+type FetchedFeed struct {
+	Endpoint  string
+	FetchedAt time.Time
+	Message   *gtfs_realtime.FeedMessage
+}
 
-	for _, entity := range feedMessage.Entity {
-		if entity.Vehicle != nil && entity.Vehicle.StopId != nil {
-			stopId := *entity.Vehicle.StopId
-			if contains(config.Stops, stopId) {
-				filteredEntities = append(filteredEntities, entity)
-			}
-		}
-		if entity.TripUpdate != nil {
-			// Filter stop_time_update for relevant stops
-			filteredStopTimeUpdates := filterStopTimeUpdates(entity.TripUpdate.StopTimeUpdate, config.Stops)
-			if len(filteredStopTimeUpdates) > 0 {
-				if entity.TripUpdate.Trip != nil {
-					routeId := *entity.TripUpdate.Trip.RouteId
-					if routeId == config.TripRouteID {
-						entity.TripUpdate.StopTimeUpdate = filteredStopTimeUpdates
-						filteredEntities = append(filteredEntities, entity)
+// fetchFeeds fetches and decodes the endpoints concurrently. Endpoints that fail are left out of the result,
+// and responses that fail validation are sent to the dead-letter topic.
+func fetchFeeds(ctx context.Context, client *http.Client, writer *kafka.Writer, deadLetterTopic string, endpoints []string) map[string]*FetchedFeed {
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		feeds = make(map[string]*FetchedFeed)
+	)
+
+	for _, endpoint := range endpoints {
+		wg.Add(1)
+		go func(endpoint string) {
+			defer wg.Done()
+
+			feedMessage, err := fetchFeed(ctx, client, endpoint)
+			if err != nil {
+				slog.Error("Error fetching feed", "endpoint", endpoint, "error", err)
+
+				var rejected *RejectedPayloadError
+				if errors.As(err, &rejected) {
+					if err := publishDeadLetter(writer, deadLetterTopic, endpoint, rejected); err != nil {
+						slog.Error("Error writing dead letter to Kafka", "endpoint", endpoint, "topic", deadLetterTopic, "error", err)
 					}
 				}
+				return
 			}
-		}
-	}
 
-	// Log the number of entities filtered for the line
-	log.Printf("Filtered %d entities for %s", len(filteredEntities), config.Name)
+			fetchedAt := time.Now()
+			health.fetched(endpoint, fetchedAt)
+			mu.Lock()
+			feeds[endpoint] = &FetchedFeed{
+				Endpoint:  endpoint,
+				FetchedAt: fetchedAt,
+				Message:   feedMessage,
+			}
+			mu.Unlock()
+		}(endpoint)
+	}
+	wg.Wait()
 
-	return &gtfs_realtime.FeedMessage{Entity: filteredEntities}
+	return feeds
 }
 
-// filterStopTimeUpdates filters the stop time updates for relevant stops
-func filterStopTimeUpdates(updates []*gtfs_realtime.TripUpdate_StopTimeUpdate, relevantStops []string) []*gtfs_realtime.TripUpdate_StopTimeUpdate {
-	var filtered []*gtfs_realtime.TripUpdate_StopTimeUpdate
-	for _, update := range updates {
-		if update.StopId != nil {
-			stopId := *update.StopId
-			if contains(relevantStops, stopId) {
-				filtered = append(filtered, update)
-			}
+// fetchFeed fetches a GTFS-realtime feed and decodes it, rejecting error statuses, oversized bodies and invalid feeds
+func fetchFeed(ctx context.Context, client *http.Client, endpoint string) (_ *gtfs_realtime.FeedMessage, err error) {
+	ctx, span := tracer.Start(ctx, "fetch feed",
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("s81.feed.endpoint", endpoint)))
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := readResponse(res, maxFeedSize)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("http.response.status_code", res.StatusCode), attribute.Int("s81.feed.size", len(body)))
+
+	_, decodeSpan := tracer.Start(ctx, "decode feed")
+	feedMessage := &gtfs_realtime.FeedMessage{}
+	if err := proto.Unmarshal(body, feedMessage); err != nil {
+		rejected := &RejectedPayloadError{
+			Reason:     fmt.Sprintf("unmarshalling feed: %v", err),
+			StatusCode: res.StatusCode,
+			Body:       body,
 		}
+		endSpan(decodeSpan, rejected)
+		return nil, rejected
 	}
-	return filtered
+	decodeSpan.SetAttributes(attribute.Int("s81.feed.entities", len(feedMessage.GetEntity())))
+	decodeSpan.End()
+	slog.Info("Fetched feed", "endpoint", endpoint, "duration_ms", time.Since(start).Milliseconds(), "size", len(body),
+		"entities", len(feedMessage.GetEntity()))
+	return feedMessage, nil
 }
 
-// contains checks if a slice contains a specific item
-func contains(slice []string, item string) bool {
-	for _, s := range slice {
-		if s == item {
-			return true
+// publishStation filters the fetched feeds for each line of a station and publishes them to Kafka,
+// followed by the normalized arrivals, the arrivals deltas of lines that changed and the service alerts for all lines.
+// Sequence numbers advance even if a write fails, clients then see a gap and fetch the arrivals snapshot instead.
+func publishStation(ctx context.Context, writer *kafka.Writer, alertsTopic string, deltas *DeltaTracker, station StationConfig, feeds map[string]*FetchedFeed) {
+	ctx, span := tracer.Start(ctx, "publish station", trace.WithAttributes(attribute.String("s81.station", station.ID)))
+	defer span.End()
+
+	var arrivals []Arrival
+	var alerts []SubwayAlert
+	var statuses []FeedStatus
+	lineArrivals := make(map[string][]Arrival)
+	complete := true
+	now := time.Now()
+
+	for _, config := range station.Lines {
+		feed, ok := feeds[config.Endpoint]
+		if !ok {
+			slog.Warn("Skipping line, its feed could not be fetched", "station", station.ID, "line", config.Name)
+			complete = false
+			continue
+		}
+
+		_, filterSpan := tracer.Start(ctx, "filter feed", trace.WithAttributes(attribute.String("s81.line", config.Name)))
+		filteredFeed := filterFeedForLine(feed.Message, config)
+		filterSpan.SetAttributes(attribute.Int("s81.feed.entities", len(filteredFeed.GetEntity())))
+		filterSpan.End()
+
+		if err := publishToKafka(ctx, writer, config, feed, filteredFeed); err != nil {
+			slog.Error("Error writing feed message to Kafka", "line", config.Name, "topic", config.Topic, "error", err)
 		}
+
+		lineArrivals[config.Name] = buildArrivals(filteredFeed, config, now)
+		arrivals = append(arrivals, lineArrivals[config.Name]...)
+		alerts = mergeAlerts(alerts, extractAlerts(feed.Message, config))
+		statuses = append(statuses, newFeedStatus(config, feed))
+	}
+
+	// Keep the last complete arrivals and alerts rather than publishing a station with missing lines
+	if !complete {
+		slog.Warn("Not publishing arrivals and alerts, some feeds could not be fetched", "station", station.ID)
+		span.SetAttributes(attribute.Bool("s81.station.complete", false))
+		return
+	}
+
+	var changed []*ArrivalsDelta
+	for _, config := range station.Lines {
+		if delta := deltas.update(station.ID, config.Name, lineArrivals[config.Name], now); delta != nil {
+			changed = append(changed, delta)
+		}
+	}
+
+	// Publish the snapshot before the deltas, so a client that falls behind finds one at least as recent
+	message := newArrivalsMessage(arrivals, statuses, now)
+	message.Epoch, message.Sequences = deltas.epoch, deltas.sequences(station)
+	if err := publishJSON(ctx, writer, station.ArrivalsTopic, station.ID, message); err != nil {
+		slog.Error("Error writing arrivals message to Kafka", "station", station.ID, "topic", station.ArrivalsTopic, "error", err)
+	} else {
+		health.published(station.ID, now)
+	}
+	for _, delta := range changed {
+		if err := publishJSON(ctx, writer, station.DeltaTopic, deltaKey(station.ID, delta.Line), delta); err != nil {
+			slog.Error("Error writing arrivals delta to Kafka", "station", station.ID, "line", delta.Line, "topic", station.DeltaTopic, "error", err)
+		}
+	}
+	if err := publishJSON(ctx, writer, alertsTopic, station.ID, newAlertsMessage(station, alerts, now)); err != nil {
+		slog.Error("Error writing alerts message to Kafka", "station", station.ID, "topic", alertsTopic, "error", err)
 	}
-	return false
 }
 
-// publishToKafka publishes the feed message to Kafka
-func publishToKafka(writer *kafka.Writer, key string, feedMessage *gtfs_realtime.FeedMessage) error {
-	feedMessageJSON, err := json.Marshal(feedMessage)
+// ProducerMetadata describes where and when the producer fetched a feed
+type ProducerMetadata struct {
+	Line      string `json:"line"`
+	Endpoint  string `json:"endpoint"`
+	FetchedAt int64  `json:"fetchedAt"`
+}
+
+// SubwayFeedMessage is the filtered feed published for a line, with the producer metadata alongside the feed fields
+type SubwayFeedMessage struct {
+	*gtfs_realtime.FeedMessage
+	Producer ProducerMetadata `json:"producer"`
+}
+
+// publishToKafka publishes the filtered feed message for a line to Kafka
+func publishToKafka(ctx context.Context, writer *kafka.Writer, config SubwayConfig, feed *FetchedFeed, feedMessage *gtfs_realtime.FeedMessage) error {
+	return publishJSON(ctx, writer, config.Topic, config.Name, SubwayFeedMessage{
+		FeedMessage: feedMessage,
+		Producer: ProducerMetadata{
+			Line:      config.Name,
+			Endpoint:  feed.Endpoint,
+			FetchedAt: feed.FetchedAt.Unix(),
+		},
+	})
+}
+
+// publishJSON publishes a value encoded as JSON to a Kafka topic, in a span whose context travels in the headers.
+// The write is not canceled with ctx, so a fetched feed is still published on shutdown.
+func publishJSON(ctx context.Context, writer *kafka.Writer, topic string, key string, value any) error {
+	valueJSON, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
 
-	return writer.WriteMessages(context.Background(),
-		kafka.Message{
-			Key:   []byte(key),
-			Value: feedMessageJSON,
-		},
-	)
+	message := kafka.Message{
+		Topic: topic,
+		Key:   []byte(key),
+		Value: valueJSON,
+	}
+	_, span := startPublishSpan(ctx, &message)
+	err = writer.WriteMessages(context.Background(), message)
+	endSpan(span, err)
+	if err != nil {
+		return err
+	}
+	slog.Debug("Published message", "topic", topic, "key", key, "size", len(valueJSON))
+	return nil
 }
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gtfs_realtime "github.com/michael-hauser/s81/subway-producer/gtfs-realtime"
+	"google.golang.org/protobuf/proto"
+)
+
+// recordedLines returns the lines of the default configuration served by a recorded feed, matched by the feed name
+// at the end of the line's endpoint
+func recordedLines(name string) []SubwayConfig {
+	feed := "nyct%2F" + strings.TrimSuffix(name, ".pb")
+	var lines []SubwayConfig
+	for _, station := range defaultConfig().Stations {
+		for _, line := range station.Lines {
+			if strings.HasSuffix(line.Endpoint, feed) {
+				lines = append(lines, line)
+			}
+		}
+	}
+	return lines
+}
+
+// The recorded feeds hold whatever the MTA published when they were captured, so these tests check properties that
+// hold for any feed rather than exact arrivals
+func TestRecordedFeeds(t *testing.T) {
+	paths, err := filepath.Glob("testdata/recorded/*.pb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Skip("no recorded feeds in testdata/recorded, capture them with go run ./testdata/capture")
+	}
+
+	for _, path := range paths {
+		name := filepath.Base(path)
+		feedMessage := loadFixture(t, "recorded/"+name)
+		now := time.Unix(int64(feedMessage.GetHeader().GetTimestamp()), 0)
+
+		for _, config := range recordedLines(name) {
+			t.Run(name+"/"+config.Name, func(t *testing.T) {
+				filtered := filterFeedForLine(feedMessage, config)
+				if len(filtered.GetEntity()) == 0 {
+					// The C does not run late at night, so a recording may have none of its trains
+					t.Skipf("no trains of route %s at %v in this recording", config.TripRouteID, config.Stops)
+				}
+				checkFilteredEntities(t, feedMessage, filtered, config)
+
+				arrivals := buildArrivals(filtered, config, now)
+				counts := make(map[string]int)
+				for i, arrival := range arrivals {
+					if arrival.ArrivalTime <= now.Unix() {
+						t.Errorf("arrival %+v is not after the header timestamp %d", arrival, now.Unix())
+					}
+					if i > 0 && arrival.ArrivalTime < arrivals[i-1].ArrivalTime {
+						t.Errorf("arrivals are not sorted: %+v before %+v", arrivals[i-1], arrival)
+					}
+					if arrival.Direction != "N" && arrival.Direction != "S" {
+						t.Errorf("arrival %+v has no direction", arrival)
+					}
+					counts[arrival.Direction]++
+				}
+				for direction, count := range counts {
+					if count > maxArrivalsPerDirection {
+						t.Errorf("%d arrivals in direction %s, want at most %d", count, direction, maxArrivalsPerDirection)
+					}
+				}
+			})
+		}
+	}
+}
+
+// checkFilteredEntities checks that the filtered feed holds exactly the line's trips and vehicles at its stops, with
+// their trip descriptors and NYCT extensions unchanged
+func checkFilteredEntities(t *testing.T, feedMessage, filtered *gtfs_realtime.FeedMessage, config SubwayConfig) {
+	t.Helper()
+
+	sources := make(map[string]*gtfs_realtime.FeedEntity)
+	expected := 0
+	for _, entity := range feedMessage.GetEntity() {
+		sources[entity.GetId()] = entity
+		if filterEntity(entity, config) != nil {
+			expected++
+		}
+	}
+	if len(filtered.GetEntity()) != expected {
+		t.Errorf("kept %d entities, want %d", len(filtered.GetEntity()), expected)
+	}
+
+	for _, entity := range filtered.GetEntity() {
+		source := sources[entity.GetId()]
+		if tripUpdate := entity.GetTripUpdate(); tripUpdate != nil {
+			if tripUpdate.GetTrip().GetRouteId() != config.TripRouteID {
+				t.Errorf("entity %s is on route %s", entity.GetId(), tripUpdate.GetTrip().GetRouteId())
+			}
+			for _, update := range tripUpdate.GetStopTimeUpdate() {
+				if !contains(config.Stops, update.GetStopId()) {
+					t.Errorf("entity %s stops at %s", entity.GetId(), update.GetStopId())
+				}
+			}
+			if !proto.Equal(tripUpdate.GetTrip(), source.GetTripUpdate().GetTrip()) {
+				t.Errorf("entity %s trip descriptor changed", entity.GetId())
+			}
+		}
+		if vehicle := entity.GetVehicle(); vehicle != nil && !proto.Equal(entity, source) {
+			t.Errorf("vehicle entity %s changed", entity.GetId())
+		}
+	}
+}
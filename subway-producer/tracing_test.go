@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/michael-hauser/s81/telemetry"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestStartPublishSpanInjectsTraceContext(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	provider := sdktrace.NewTracerProvider()
+	defer provider.Shutdown(context.Background())
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "fetchAndPublishSubwayData")
+	defer parent.End()
+
+	message := kafka.Message{Topic: "arrivals-s81", Key: []byte("s81"), Headers: []kafka.Header{{Key: "other", Value: []byte("kept")}}}
+	_, span := startPublishSpan(ctx, &message)
+	span.End()
+
+	carrier := telemetry.HeaderCarrier{Headers: &message.Headers}
+	if carrier.Get("other") != "kept" {
+		t.Errorf("existing header was lost: %+v", message.Headers)
+	}
+	extracted := trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(context.Background(), carrier))
+	if !extracted.IsValid() || extracted.TraceID() != parent.SpanContext().TraceID() {
+		t.Errorf("got trace context %v from headers %+v, want trace %s", extracted, message.Headers, parent.SpanContext().TraceID())
+	}
+}
@@ -0,0 +1,64 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+)
+
+func TestNewExporter(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		endpoint string
+		expected string // Kind of exporter created, empty if tracing is disabled.
+		err      bool
+	}{
+		{"console without an endpoint", "", "", "console", false},
+		{"otlp with an endpoint", "", "http://jaeger:4318", "otlp", false},
+		{"console selected with an endpoint", "console", "http://jaeger:4318", "console", false},
+		{"otlp selected", "otlp", "", "otlp", false},
+		{"disabled", "none", "http://jaeger:4318", "", false},
+		{"unknown exporter", "zipkin", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("OTEL_TRACES_EXPORTER", tt.exporter)
+			t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", tt.endpoint)
+			t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+			exporter, err := newExporter(context.Background())
+			if (err != nil) != tt.err {
+				t.Fatalf("error %v, expected an error: %v", err, tt.err)
+			}
+			kind := ""
+			switch exporter.(type) {
+			case *otlptrace.Exporter:
+				kind = "otlp"
+			case *stdouttrace.Exporter:
+				kind = "console"
+			}
+			if kind != tt.expected {
+				t.Fatalf("created %T, expected the %q exporter", exporter, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHeaderCarrier(t *testing.T) {
+	headers := []kafka.Header{{Key: "other", Value: []byte("kept")}}
+	carrier := HeaderCarrier{&headers}
+	carrier.Set("traceparent", "first")
+	carrier.Set("traceparent", "second")
+
+	if carrier.Get("traceparent") != "second" || carrier.Get("other") != "kept" {
+		t.Fatalf("unexpected headers %+v", headers)
+	}
+	if keys := carrier.Keys(); len(keys) != 2 || keys[0] != "other" || keys[1] != "traceparent" {
+		t.Fatalf("keys %v, expected [other traceparent]", keys)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Types of alert events
+const (
+	AlertNew     = "new"
+	AlertUpdated = "updated"
+	AlertExpired = "expired"
+)
+
+// AlertEvent is published to the alerts topic whenever an alert appears, changes or ends, documented in SCHEMA.md
+type AlertEvent struct {
+	SchemaVersion int      `json:"schemaVersion"`
+	Type          string   `json:"type"`
+	ID            string   `json:"id"`
+	Location      string   `json:"location"`
+	Sender        string   `json:"sender"`
+	Event         string   `json:"event"`
+	Start         string   `json:"start"`
+	End           string   `json:"end"`
+	Description   string   `json:"description"`
+	Tags          []string `json:"tags"`
+	PublishedAt   string   `json:"publishedAt"`
+}
+
+// alertChange is an alert that appeared, changed or ended since the previous poll
+type alertChange struct {
+	Type  string
+	ID    string
+	Alert WeatherAlert
+}
+
+// AlertTracker remembers the active alerts of a location across polls, so each alert is only published when it changes
+type AlertTracker struct {
+	location string
+	active   map[string]WeatherAlert
+}
+
+// newAlertTracker creates a tracker with no active alerts
+func newAlertTracker(location string) *AlertTracker {
+	return &AlertTracker{location: location, active: make(map[string]WeatherAlert)}
+}
+
+// diff compares the alerts of the latest poll with the active ones and returns the changes and the new set of
+// active alerts. Alerts are identified by sender, event and start time, alerts missing from the poll or past
+// their end are expired.
+func (t *AlertTracker) diff(alerts []WeatherAlert, now time.Time) ([]alertChange, map[string]WeatherAlert) {
+	current := make(map[string]WeatherAlert)
+	for _, alert := range alerts {
+		if !alert.End.IsZero() && !alert.End.After(now) {
+			continue
+		}
+		current[t.alertID(alert)] = alert
+	}
+
+	var changes []alertChange
+	for id, alert := range current {
+		previous, ok := t.active[id]
+		switch {
+		case !ok:
+			changes = append(changes, alertChange{Type: AlertNew, ID: id, Alert: alert})
+		case !reflect.DeepEqual(previous, alert):
+			changes = append(changes, alertChange{Type: AlertUpdated, ID: id, Alert: alert})
+		}
+	}
+	for id, alert := range t.active {
+		if _, ok := current[id]; !ok {
+			changes = append(changes, alertChange{Type: AlertExpired, ID: id, Alert: alert})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if !changes[i].Alert.Start.Equal(changes[j].Alert.Start) {
+			return changes[i].Alert.Start.Before(changes[j].Alert.Start)
+		}
+		return changes[i].ID < changes[j].ID
+	})
+	return changes, current
+}
+
+// alertID derives a stable ID from the location, sender, event and start time of an alert
+func (t *AlertTracker) alertID(alert WeatherAlert) string {
+	hash := sha256.Sum256([]byte(t.location + "\x00" + alert.Sender + "\x00" + alert.Event + "\x00" +
+		strconv.FormatInt(alert.Start.Unix(), 10)))
+	return hex.EncodeToString(hash[:8])
+}
+
+// newAlertEvent maps an alert change into the published event, with times in the location's timezone
+func newAlertEvent(change alertChange, location LocationConfig, now time.Time) AlertEvent {
+	timezone := location.timezone()
+	return AlertEvent{
+		SchemaVersion: weatherSchemaVersion,
+		Type:          change.Type,
+		ID:            change.ID,
+		Location:      location.Name,
+		Sender:        change.Alert.Sender,
+		Event:         change.Alert.Event,
+		Start:         change.Alert.Start.In(timezone).Format(time.RFC3339),
+		End:           change.Alert.End.In(timezone).Format(time.RFC3339),
+		Description:   change.Alert.Description,
+		Tags:          change.Alert.Tags,
+		PublishedAt:   now.In(timezone).Format(time.RFC3339),
+	}
+}
+
+// publishAlerts publishes an event for every alert that appeared, changed or ended, keyed by the alert ID.
+// The active alerts are only replaced once the events are written, so failed writes are retried on the next poll.
+func (p *Poller) publishAlerts(alerts []WeatherAlert, now time.Time) {
+	changes, active := p.alerts.diff(alerts, now)
+	if len(changes) == 0 {
+		return
+	}
+
+	messages := make([]kafka.Message, 0, len(changes))
+	for _, change := range changes {
+		eventJSON, err := json.Marshal(newAlertEvent(change, p.location, now))
+		if err != nil {
+			slog.Error("Error marshaling weather alert", "location", p.location.Name, "error", err)
+			continue
+		}
+		messages = append(messages, kafka.Message{
+			Topic: p.config.AlertsTopic,
+			Key:   []byte(change.ID),
+			Value: eventJSON,
+		})
+		slog.Info("Weather alert", "location", p.location.Name, "type", change.Type, "event", change.Alert.Event)
+	}
+
+	if err := p.writer.WriteMessages(context.Background(), messages...); err != nil {
+		slog.Error("Error writing weather alerts to Kafka", "location", p.location.Name, "topic", p.config.AlertsTopic, "error", err)
+		return
+	}
+	p.alerts.active = active
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAlertTrackerDiff(t *testing.T) {
+	start := time.Date(2024, 9, 17, 10, 0, 0, 0, time.UTC)
+	heat := WeatherAlert{Sender: "NWS", Event: "Heat Advisory", Start: start, End: start.Add(8 * time.Hour), Description: "Heat index up to 100."}
+	heatExtended := heat
+	heatExtended.End = start.Add(12 * time.Hour)
+	flood := WeatherAlert{Sender: "NWS", Event: "Flood Watch", Start: start.Add(time.Hour), End: start.Add(6 * time.Hour)}
+
+	type change struct {
+		Type  string
+		Event string
+	}
+	polls := []struct {
+		name   string
+		now    time.Time
+		alerts []WeatherAlert
+		want   []change
+	}{
+		{
+			name:   "new alerts are published once, duplicates in a poll collapse",
+			now:    start,
+			alerts: []WeatherAlert{heat, flood, heat},
+			want:   []change{{AlertNew, "Heat Advisory"}, {AlertNew, "Flood Watch"}},
+		},
+		{
+			name:   "unchanged alerts are not republished",
+			now:    start.Add(10 * time.Minute),
+			alerts: []WeatherAlert{flood, heat},
+		},
+		{
+			name:   "a changed end time is an update of the same alert",
+			now:    start.Add(20 * time.Minute),
+			alerts: []WeatherAlert{heatExtended, flood},
+			want:   []change{{AlertUpdated, "Heat Advisory"}},
+		},
+		{
+			name:   "alerts past their end expire even if still listed",
+			now:    start.Add(7 * time.Hour),
+			alerts: []WeatherAlert{heatExtended, flood},
+			want:   []change{{AlertExpired, "Flood Watch"}},
+		},
+		{
+			name:   "alerts missing from the poll expire",
+			now:    start.Add(8 * time.Hour),
+			alerts: nil,
+			want:   []change{{AlertExpired, "Heat Advisory"}},
+		},
+	}
+
+	tracker := newAlertTracker("s81")
+	for _, poll := range polls {
+		changes, active := tracker.diff(poll.alerts, poll.now)
+		tracker.active = active
+
+		var got []change
+		for _, c := range changes {
+			if c.ID != tracker.alertID(c.Alert) {
+				t.Errorf("%s: change ID %s does not match alert", poll.name, c.ID)
+			}
+			got = append(got, change{c.Type, c.Alert.Event})
+		}
+		if !reflect.DeepEqual(got, poll.want) {
+			t.Errorf("%s: changes = %v, want %v", poll.name, got, poll.want)
+		}
+	}
+}
+
+func TestAlertIDIsStableAcrossUpdates(t *testing.T) {
+	tracker := newAlertTracker("s81")
+	start := time.Date(2024, 9, 17, 10, 0, 0, 0, time.UTC)
+	alert := WeatherAlert{Sender: "NWS", Event: "Heat Advisory", Start: start, End: start.Add(time.Hour)}
+	updated := alert
+	updated.End = start.Add(2 * time.Hour)
+	updated.Description = "Extended"
+
+	if tracker.alertID(alert) != tracker.alertID(updated) {
+		t.Error("alert ID changed when the end time and description changed")
+	}
+	if tracker.alertID(alert) == newAlertTracker("zurich-hb").alertID(alert) {
+		t.Error("alert ID is the same for different locations")
+	}
+}
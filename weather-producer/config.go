@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config holds the weather provider and the locations the producer fetches weather for
+type Config struct {
+	Provider    string           `json:"provider"`
+	ProviderURL string           `json:"providerUrl"`
+	Locations   []LocationConfig `json:"locations"`
+}
+
+// LocationConfig holds the coordinates and output settings for a named location
+type LocationConfig struct {
+	Name     string  `json:"name"`
+	Lat      float64 `json:"lat"`
+	Lon      float64 `json:"lon"`
+	Timezone string  `json:"timezone"`
+	Units    string  `json:"units"`
+	Lang     string  `json:"lang"`
+	Topic    string  `json:"topic"`
+	Key      string  `json:"key"`
+
+	tz *time.Location // Loaded from Timezone by validate.
+}
+
+// defaultConfig returns the configuration used when no configuration file or environment variable is set.
+// It covers 81 St-Museum of Natural History. Each call returns a new slice, since validate fills in the locations
+// in place.
+func defaultConfig() Config {
+	return Config{
+		Provider: ProviderOpenWeather,
+		Locations: []LocationConfig{
+			{
+				Name:     "s81",
+				Lat:      40.781433,
+				Lon:      -73.972143,
+				Timezone: "America/New_York",
+				Units:    "imperial",
+				Lang:     "en",
+				Topic:    "weather-data",
+				Key:      "weather",
+			},
+		},
+	}
+}
+
+// validUnits are the unit systems supported by the OpenWeather API, the other providers have no "standard" (Kelvin) units
+var validUnits = map[string]bool{"standard": true, "metric": true, "imperial": true}
+
+// loadConfig reads the configuration from WEATHER_CONFIG_FILE, then WEATHER_CONFIG, falling back to the defaults.
+// WEATHER_PROVIDER and WEATHER_PROVIDER_URL override the provider from the configuration.
+func loadConfig() (*Config, error) {
+	var data []byte
+	if path := os.Getenv("WEATHER_CONFIG_FILE"); path != "" {
+		fileData, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		data = fileData
+	} else if env := os.Getenv("WEATHER_CONFIG"); env != "" {
+		data = []byte(env)
+	}
+
+	config := defaultConfig()
+	if data != nil {
+		config = Config{}
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("parsing config: %w", err)
+		}
+	}
+	if env := os.Getenv("WEATHER_PROVIDER"); env != "" {
+		config.Provider = env
+	}
+	if env := os.Getenv("WEATHER_PROVIDER_URL"); env != "" {
+		config.ProviderURL = env
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// validate checks the configuration for missing fields and fills in defaults
+func (c *Config) validate() error {
+	if c.Provider == "" {
+		c.Provider = ProviderOpenWeather
+	}
+	if c.Provider != ProviderOpenWeather && c.Provider != ProviderNWS && c.Provider != ProviderOpenMeteo {
+		return fmt.Errorf("unknown provider %q", c.Provider)
+	}
+	if len(c.Locations) == 0 {
+		return errors.New("config must define at least one location")
+	}
+
+	names := make(map[string]bool)
+	keys := make(map[string]string) // Location names by topic and key.
+	for i := range c.Locations {
+		location := &c.Locations[i]
+		if location.Name == "" {
+			return fmt.Errorf("location %d: name is required", i)
+		}
+		if names[location.Name] {
+			return fmt.Errorf("location %s: duplicate name", location.Name)
+		}
+		names[location.Name] = true
+
+		if location.Lat == 0 && location.Lon == 0 {
+			return fmt.Errorf("location %s: lat and lon are required", location.Name)
+		}
+		if location.Lat < -90 || location.Lat > 90 || location.Lon < -180 || location.Lon > 180 {
+			return fmt.Errorf("location %s: coordinates out of range", location.Name)
+		}
+		if location.Timezone == "" {
+			return fmt.Errorf("location %s: timezone is required", location.Name)
+		}
+		tz, err := time.LoadLocation(location.Timezone)
+		if err != nil {
+			return fmt.Errorf("location %s: invalid timezone %q", location.Name, location.Timezone)
+		}
+		location.tz = tz
+		if location.Units == "" {
+			location.Units = "imperial"
+		}
+		if !validUnits[location.Units] || (location.Units == "standard" && c.Provider != ProviderOpenWeather) {
+			return fmt.Errorf("location %s: invalid units %q for provider %s", location.Name, location.Units, c.Provider)
+		}
+		if location.Lang == "" {
+			location.Lang = "en"
+		}
+		if location.Topic == "" {
+			location.Topic = "weather-data"
+		}
+		if location.Key == "" {
+			location.Key = location.Name
+		}
+		// Clients and the websocket-server tell locations sharing a topic apart by key
+		topicKey := location.Topic + "/" + location.Key
+		if other, ok := keys[topicKey]; ok {
+			return fmt.Errorf("location %s: topic %s and key %s are already used by location %s", location.Name,
+				location.Topic, location.Key, other)
+		}
+		keys[topicKey] = location.Name
+	}
+	return nil
+}
+
+// timezone returns the location's timezone, or UTC if the configuration was not validated
+func (l LocationConfig) timezone() *time.Location {
+	if l.tz == nil {
+		return time.UTC
+	}
+	return l.tz
+}
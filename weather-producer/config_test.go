@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigDoesNotShareDefaults(t *testing.T) {
+	t.Setenv("WEATHER_CONFIG_FILE", "")
+	t.Setenv("WEATHER_CONFIG", "")
+	t.Setenv("WEATHER_PROVIDER", "")
+	t.Setenv("WEATHER_PROVIDER_URL", "")
+
+	first, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Locations[0].Topic = "changed"
+
+	second, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Locations[0].Topic != "weather-data" || defaultConfig().Locations[0].Topic != "weather-data" {
+		t.Fatalf("changing a loaded configuration changed the defaults: %+v", second.Locations[0])
+	}
+}
+
+func TestValidateLocations(t *testing.T) {
+	location := func(name, topic, key string) LocationConfig {
+		return LocationConfig{Name: name, Lat: 40.78, Lon: -73.97, Timezone: "America/New_York", Topic: topic, Key: key}
+	}
+	tests := []struct {
+		name      string
+		locations []LocationConfig
+		err       string // Expected part of the error, empty if the configuration is valid.
+	}{
+		{"distinct keys on a shared topic", []LocationConfig{location("s81", "", ""), location("s72", "", "")}, ""},
+		{"same key on different topics", []LocationConfig{location("s81", "weather-s81", "weather"),
+			location("s72", "weather-s72", "weather")}, ""},
+		{"duplicate name", []LocationConfig{location("s81", "", ""), location("s81", "", "other")}, "duplicate name"},
+		{"duplicate key on a shared topic", []LocationConfig{location("s81", "", "weather"),
+			location("s72", "", "weather")}, "already used by location s81"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{Provider: ProviderOpenMeteo, Locations: tt.locations}
+			err := config.validate()
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.err)
+			}
+		})
+	}
+}
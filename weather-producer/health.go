@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	defaultHealthPort = "8083"          // Default port serving /healthz and /readyz
+	kafkaCheckTimeout = 2 * time.Second // Time allowed for the Kafka check of /readyz
+)
+
+// ReadinessConfig holds the thresholds /readyz checks the pollers against
+type ReadinessConfig struct {
+	MaxAge time.Duration // A location last fetched and published longer ago than this is not ready
+}
+
+// loadReadinessConfig reads the readiness thresholds from READY_MAX_AGE, defaulting to three poll intervals
+func loadReadinessConfig(pollConfig PollConfig) (ReadinessConfig, error) {
+	config := ReadinessConfig{MaxAge: 3 * pollConfig.Interval}
+	if env := os.Getenv("READY_MAX_AGE"); env != "" {
+		maxAge, err := time.ParseDuration(env)
+		if err != nil || maxAge <= 0 {
+			return config, fmt.Errorf("READY_MAX_AGE must be a positive duration, got %q", env)
+		}
+		config.MaxAge = maxAge
+	}
+	return config, nil
+}
+
+// checkState returns why a location is not ready, or nil if it is
+func checkState(state LocationState, maxAge time.Duration, now time.Time) error {
+	if state.LastSuccess.IsZero() {
+		if state.ErrorCategory != "" {
+			return fmt.Errorf("not published yet, last error: %s", state.ErrorCategory)
+		}
+		return errors.New("not published yet")
+	}
+	if age := now.Sub(state.LastSuccess); age > maxAge {
+		return fmt.Errorf("last published %s ago, last error: %s", age.Round(time.Second), state.ErrorCategory)
+	}
+	return nil
+}
+
+// checkKafka connects to the broker and reads its metadata
+func checkKafka(ctx context.Context, kafkaURL string) error {
+	ctx, cancel := context.WithTimeout(ctx, kafkaCheckTimeout)
+	defer cancel()
+
+	conn, err := kafka.DialContext(ctx, "tcp", kafkaURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(kafkaCheckTimeout))
+
+	brokers, err := conn.Brokers()
+	if err != nil {
+		return err
+	}
+	if len(brokers) == 0 {
+		return errors.New("no brokers available")
+	}
+	return nil
+}
+
+// healthResponse is the body of /healthz and /readyz, checks maps each check to "ok" or the reason it failed
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// newHealthServer creates the HTTP server for /healthz and /readyz on HEALTH_PORT
+func newHealthServer(kafkaURL string, readiness ReadinessConfig, pollers []*Poller) *http.Server {
+	port := os.Getenv("HEALTH_PORT")
+	if port == "" {
+		port = defaultHealthPort
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		checks := map[string]error{"kafka": checkKafka(r.Context(), kafkaURL)}
+		for _, poller := range pollers {
+			state := poller.State()
+			checks["location:"+state.Location] = checkState(state, readiness.MaxAge, now)
+		}
+
+		response := healthResponse{Status: "ready", Checks: make(map[string]string)}
+		status := http.StatusOK
+		for name, err := range checks {
+			if err != nil {
+				response.Status = "not ready"
+				response.Checks[name] = err.Error()
+				status = http.StatusServiceUnavailable
+				continue
+			}
+			response.Checks[name] = "ok"
+		}
+		writeHealth(w, status, response)
+	})
+	return &http.Server{Addr: ":" + port, Handler: mux}
+}
+
+// writeHealth writes a health response as JSON
+func writeHealth(w http.ResponseWriter, status int, response healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Error writing health response", "error", err)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckState(t *testing.T) {
+	now := time.Date(2024, 9, 17, 10, 0, 0, 0, time.UTC)
+	maxAge := 30 * time.Minute
+
+	tests := []struct {
+		name  string
+		state LocationState
+		want  string
+	}{
+		{"never polled", LocationState{}, "not published yet"},
+		{"failing since start", LocationState{ErrorCategory: ErrorUnavailable}, "not published yet, last error: unavailable"},
+		{"recent success", LocationState{LastSuccess: now.Add(-10 * time.Minute)}, ""},
+		{"stale success", LocationState{LastSuccess: now.Add(-time.Hour), ErrorCategory: ErrorRateLimited}, "last published 1h0m0s ago, last error: rate_limited"},
+	}
+	for _, test := range tests {
+		err := checkState(test.state, maxAge, now)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
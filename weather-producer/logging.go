@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const serviceName = "weather-producer" // Value of the service field of every log record
+
+// logLevel is the minimum level logged, changed at runtime through /admin/log-level on the admin listener
+var logLevel = new(slog.LevelVar)
+
+// sensitiveKeys are log attribute keys whose values are never logged, the provider API key and the admin token
+var sensitiveKeys = map[string]bool{
+	"authorization": true,
+	"apikey":        true,
+	"api_key":       true,
+	"appid":         true,
+}
+
+// Patterns of secrets embedded in log messages and errors, such as OpenWeather URLs with the API key in the query
+var (
+	apiKeyParamPattern = regexp.MustCompile(`(?i)\b(appid|api_?key)=[^&\s"']+`)
+	bearerPattern      = regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9._~+/=-]+`)
+)
+
+// setupLogging makes the default logger write JSON records at the level in LOG_LEVEL, INFO if unset
+func setupLogging() error {
+	if env := os.Getenv("LOG_LEVEL"); env != "" {
+		if err := logLevel.UnmarshalText([]byte(env)); err != nil {
+			return fmt.Errorf("LOG_LEVEL must be DEBUG, INFO, WARN or ERROR, got %q", env)
+		}
+	}
+	slog.SetDefault(slog.New(newLogHandler(os.Stdout, logLevel)))
+	return nil
+}
+
+// newLogHandler creates a JSON handler that tags records with the service and redacts secrets
+func newLogHandler(w io.Writer, level slog.Leveler) slog.Handler {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr})
+	return handler.WithAttrs([]slog.Attr{slog.String("service", serviceName)})
+}
+
+// redactAttr hides the values of sensitive keys and the secrets inside strings and errors
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, "[REDACTED]")
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redact(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, redact(err.Error()))
+		}
+	}
+	return a
+}
+
+// redact replaces API keys in query parameters and bearer credentials
+func redact(s string) string {
+	s = apiKeyParamPattern.ReplaceAllString(s, "$1=[REDACTED]")
+	return bearerPattern.ReplaceAllString(s, "${1}[REDACTED]")
+}
+
+// fatal logs an error and exits
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
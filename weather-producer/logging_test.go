@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogHandlerRedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(newLogHandler(&buf, slog.LevelInfo))
+
+	logger.Info("Fetching https://api.openweathermap.org/data/3.0/onecall?lat=40.7&appid=SECRET1&units=metric",
+		"error", errors.New(`Get "https://api.openweathermap.org/data/3.0/onecall?appid=SECRET2": context deadline exceeded`),
+		"apiKey", "SECRET3",
+		"header", "Bearer SECRET4",
+		"location", "New York")
+	logger.Debug("Not logged at INFO")
+
+	if strings.Count(buf.String(), "\n") != 1 {
+		t.Fatalf("expected a single record, got %q", buf.String())
+	}
+	if strings.Contains(buf.String(), "SECRET") {
+		t.Errorf("secret leaked into %s", buf.String())
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"msg":      "Fetching https://api.openweathermap.org/data/3.0/onecall?lat=40.7&appid=[REDACTED]&units=metric",
+		"error":    `Get "https://api.openweathermap.org/data/3.0/onecall?appid=[REDACTED]": context deadline exceeded`,
+		"apiKey":   "[REDACTED]",
+		"header":   "Bearer [REDACTED]",
+		"location": "New York",
+		"service":  "weather-producer",
+	}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("%s: got %v, want %v", key, record[key], value)
+		}
+	}
+}
@@ -2,25 +2,36 @@ package main
 
 import (
 	"context"
-	"io"
-	"log"
+	"encoding/json"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
+	_ "time/tzdata" // Location timezones must resolve in containers without a zoneinfo database.
 
 	"github.com/joho/godotenv"
+	"github.com/michael-hauser/s81/telemetry"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// Mutex for synchronizing writes to WebSocket connection.
-var wsMutex sync.Mutex
+// defaultShutdownTimeout is the deadline after a shutdown signal for in-flight polls, closing the Kafka writer and
+// flushing traces together, below the 10 seconds Docker waits before killing
+const defaultShutdownTimeout = 8 * time.Second
 
 func main() {
 	// Load environment variables from .env file
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		fatal("Error loading .env file", "error", err)
+	}
+	if err := setupLogging(); err != nil {
+		fatal("Invalid logging configuration", "error", err)
 	}
 
 	kafkaURL := os.Getenv("KAFKA_URL")
@@ -28,65 +39,173 @@ func main() {
 	if kafkaURL == "" {
 		kafkaURL = "localhost:9093"
 	}
-	topic := "weather-data"
 
+	config, err := loadConfig()
+	if err != nil {
+		fatal("Invalid weather configuration", "error", err)
+	}
+	provider, err := newProvider(config, apiKey)
+	if err != nil {
+		fatal("Invalid weather provider", "error", err)
+	}
+	pollConfig, err := loadPollConfig()
+	if err != nil {
+		fatal("Invalid poll configuration", "error", err)
+	}
+	shutdownTimeout, err := loadShutdownTimeout()
+	if err != nil {
+		fatal("Invalid shutdown configuration", "error", err)
+	}
+	readiness, err := loadReadinessConfig(pollConfig)
+	if err != nil {
+		fatal("Invalid readiness configuration", "error", err)
+	}
+
+	// Cancel the root context on SIGTERM or SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	shutdownTracing, err := telemetry.Setup(ctx, serviceName)
+	if err != nil {
+		fatal("Invalid tracing configuration", "error", err)
+	}
+
+	// Create a Kafka writer shared by all locations, each message names its own topic
 	writer := kafka.NewWriter(kafka.WriterConfig{
 		Brokers: []string{kafkaURL},
-		Topic:   topic,
 	})
-	defer writer.Close()
 
-	log.Println("Weather producer started")
+	slog.Info("Weather producer started", "provider", provider.Name(), "interval", pollConfig.Interval.String())
+
+	// Poll each location on its own schedule, starting immediately
+	var pollers []*Poller
+	var running sync.WaitGroup
+	for _, location := range config.Locations {
+		poller := newPoller(writer, provider, location, pollConfig)
+		pollers = append(pollers, poller)
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			poller.run(ctx)
+		}()
+	}
 
-	// Run the function immediately
-	go fetchAndPublishWeatherData(writer, apiKey)
+	// Serve /healthz and /readyz
+	healthServer := newHealthServer(kafkaURL, readiness, pollers)
+	go func() {
+		if err := healthServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("Failed to start health server", "error", err)
+		}
+	}()
 
-	// Set the interval for fetching data to every 10 minutes
-	interval := 10 * time.Second
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	// Serve the admin endpoints on their own internal listener, only when a token protects them
+	adminServer := newAdminServer()
+	if adminServer != nil {
+		go func() {
+			slog.Info("Admin server starting", "addr", adminServer.Addr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("Failed to start admin server", "error", err)
+			}
+		}()
+	} else {
+		slog.Info("ADMIN_TOKEN is not set, admin endpoints are disabled")
+	}
 
-	// Set up a goroutine to run the function periodically
+	// Let in-flight polls finish publishing, then flush the writer
+	<-ctx.Done()
+	slog.Info("Shutting down", "deadline", shutdownTimeout.String())
+	drainCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	done := make(chan struct{})
 	go func() {
-		for range ticker.C {
-			fetchAndPublishWeatherData(writer, apiKey)
-		}
+		running.Wait()
+		close(done)
 	}()
+	select {
+	case <-done:
+	case <-drainCtx.Done():
+		slog.Warn("Shutdown deadline reached before publishing finished")
+	}
+	if err := healthServer.Close(); err != nil {
+		slog.Error("Error closing health server", "error", err)
+	}
+	if adminServer != nil {
+		adminServer.Close()
+	}
+	if err := closeWriter(drainCtx, writer); err != nil {
+		slog.Error("Error closing Kafka writer", "error", err)
+	}
+	if err := shutdownTracing(drainCtx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+	slog.Info("Weather producer stopped")
+}
 
-	// Block main thread
-	select {}
+// loadShutdownTimeout reads the drain deadline from SHUTDOWN_TIMEOUT
+func loadShutdownTimeout() (time.Duration, error) {
+	env := os.Getenv("SHUTDOWN_TIMEOUT")
+	if env == "" {
+		return defaultShutdownTimeout, nil
+	}
+	timeout, err := time.ParseDuration(env)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("SHUTDOWN_TIMEOUT must be a positive duration, got %q", env)
+	}
+	return timeout, nil
 }
 
-func fetchAndPublishWeatherData(writer *kafka.Writer, apiKey string) {
-	wsMutex.Lock()
-	defer wsMutex.Unlock()
+// closeWriter flushes and closes the Kafka writer, giving up when ctx is done. The writer has no deadline of its
+// own and blocks while the brokers are unreachable
+func closeWriter(ctx context.Context, writer *kafka.Writer) error {
+	closed := make(chan error, 1)
+	go func() {
+		closed <- writer.Close()
+	}()
+	select {
+	case err := <-closed:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("flushing pending messages: %w", ctx.Err())
+	}
+}
 
-	lat := "40.781433"
-	long := "-73.972143"
-	weatherEndpoint := "https://api.openweathermap.org/data/3.0/onecall?units=imperial&lat=" + lat + "&lon=" + long + "&appid=" + apiKey
+// fetchAndPublishWeatherData fetches the weather data for a location from the provider, publishes it to Kafka
+// and returns it. Canceling ctx aborts the fetch, a fetched message is still published. It is safe to call for
+// several locations at once, each poller calls it for its own location.
+// Each call starts a trace, carried to the consumers in the headers of the published message.
+func fetchAndPublishWeatherData(ctx context.Context, writer *kafka.Writer, provider WeatherProvider, location LocationConfig) (_ *Weather, err error) {
+	ctx, span := tracer.Start(ctx, "fetchAndPublishWeatherData", trace.WithAttributes(
+		attribute.String("s81.location", location.Name), attribute.String("s81.provider", provider.Name())))
+	defer func() { endSpan(span, err) }()
 
-	log.Println("Fetching weather data from:", weatherEndpoint)
+	logger := slog.With("location", location.Name, "provider", provider.Name(), "topic", location.Topic)
+	logger.Debug("Fetching weather data")
 
-	res, err := http.Get(weatherEndpoint)
+	start := time.Now()
+	weather, err := provider.Fetch(ctx, location)
 	if err != nil {
-		log.Println("Error fetching weather data:", err)
-		return
+		return nil, err
 	}
-	defer res.Body.Close()
-
-	log.Println("Weather data fetched successfully")
+	fetchDuration := time.Since(start)
 
-	body, _ := io.ReadAll(res.Body)
-	err = writer.WriteMessages(context.Background(),
-		kafka.Message{
-			Key:   []byte("weather"),
-			Value: body,
-		},
-	)
-
-	log.Println("Weather data published to Kafka")
+	message := newWeatherMessage(weather, location, provider.Name(), time.Now())
+	weatherJSON, err := json.Marshal(message)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling weather data: %w", err)
+	}
 
+	kafkaMessage := kafka.Message{
+		Topic: location.Topic,
+		Key:   []byte(location.Key),
+		Value: weatherJSON,
+	}
+	_, publishSpan := startPublishSpan(ctx, &kafkaMessage)
+	err = writer.WriteMessages(context.Background(), kafkaMessage)
+	endSpan(publishSpan, err)
 	if err != nil {
-		log.Println("Error writing message to Kafka:", err)
+		return nil, fmt.Errorf("writing message to Kafka: %w", err)
 	}
+
+	logger.Info("Fetched and published weather data", "duration_ms", fetchDuration.Milliseconds(), "size", len(weatherJSON))
+	return weather, nil
 }
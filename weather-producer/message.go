@@ -0,0 +1,97 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// weatherSchemaVersion is the version of WeatherMessage. It is bumped whenever a field is removed or its meaning
+// changes, adding a field keeps the version.
+const weatherSchemaVersion = 1
+
+// WeatherMessage is the message published to the weather topics, documented in SCHEMA.md.
+// Timestamps are RFC 3339 in the location's timezone and dates are calendar days in that timezone.
+type WeatherMessage struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	Location      string         `json:"location"`
+	Timezone      string         `json:"timezone"`
+	Provider      string         `json:"provider"`
+	GeneratedAt   string         `json:"generatedAt"`
+	Units         WeatherUnits   `json:"units"`
+	Current       CurrentMessage `json:"current"`
+	Daily         []DailyMessage `json:"daily"`
+}
+
+// WeatherUnits names the units of the values in a message
+type WeatherUnits struct {
+	Temperature string `json:"temperature"`
+	WindSpeed   string `json:"windSpeed"`
+	Probability string `json:"probability"`
+}
+
+// CurrentMessage holds the current conditions shown on the weather widget
+type CurrentMessage struct {
+	Time        string    `json:"time"`
+	Temperature float64   `json:"temperature"`
+	FeelsLike   float64   `json:"feelsLike"`
+	WindSpeed   float64   `json:"windSpeed"`
+	Condition   Condition `json:"condition"`
+	Description string    `json:"description,omitempty"`
+	IsDay       bool      `json:"isDay"`
+}
+
+// DailyMessage holds the forecast for a day shown on the forecast widget
+type DailyMessage struct {
+	Date                     string    `json:"date"`
+	TemperatureMax           float64   `json:"temperatureMax"`
+	TemperatureMin           float64   `json:"temperatureMin"`
+	PrecipitationProbability float64   `json:"precipitationProbability"`
+	Condition                Condition `json:"condition"`
+}
+
+// unitSystems maps the configured units to the units named in messages
+var unitSystems = map[string]WeatherUnits{
+	"standard": {Temperature: "K", WindSpeed: "m/s", Probability: "%"},
+	"metric":   {Temperature: "°C", WindSpeed: "m/s", Probability: "%"},
+	"imperial": {Temperature: "°F", WindSpeed: "mph", Probability: "%"},
+}
+
+// newWeatherMessage maps the provider's weather into the published schema, converting times to the location's
+// timezone and rounding values to one decimal
+func newWeatherMessage(weather *Weather, location LocationConfig, provider string, now time.Time) WeatherMessage {
+	timezone := location.timezone()
+	message := WeatherMessage{
+		SchemaVersion: weatherSchemaVersion,
+		Location:      location.Name,
+		Timezone:      timezone.String(),
+		Provider:      provider,
+		GeneratedAt:   now.In(timezone).Format(time.RFC3339),
+		Units:         unitSystems[location.Units],
+		Current: CurrentMessage{
+			Time:        weather.Current.Time.In(timezone).Format(time.RFC3339),
+			Temperature: round(weather.Current.Temperature),
+			FeelsLike:   round(weather.Current.FeelsLike),
+			WindSpeed:   round(weather.Current.WindSpeed),
+			Condition:   weather.Current.Condition,
+			Description: weather.Current.Description,
+			IsDay:       weather.Current.IsDay,
+		},
+		Daily: []DailyMessage{},
+	}
+
+	for _, day := range weather.Daily {
+		message.Daily = append(message.Daily, DailyMessage{
+			Date:                     day.Date.In(timezone).Format(time.DateOnly),
+			TemperatureMax:           round(day.TemperatureMax),
+			TemperatureMin:           round(day.TemperatureMin),
+			PrecipitationProbability: math.Round(day.PrecipitationProbability),
+			Condition:                day.Condition,
+		})
+	}
+	return message
+}
+
+// round rounds a value to one decimal
+func round(value float64) float64 {
+	return math.Round(value*10) / 10
+}
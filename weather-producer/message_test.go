@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNewWeatherMessage(t *testing.T) {
+	config := &Config{Locations: []LocationConfig{s81}}
+	if err := config.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+	location := config.Locations[0]
+
+	weather := &Weather{
+		Current: CurrentWeather{
+			Time: unixTime(1726574400), Temperature: 72.46, FeelsLike: 73.14, WindSpeed: 8.05,
+			Condition: ConditionCloudy, Description: "scattered clouds", IsDay: true,
+		},
+		Daily: []DailyWeather{
+			// 02:00 UTC is still the previous evening in New York
+			{Date: time.Date(2024, 9, 18, 2, 0, 0, 0, time.UTC), TemperatureMax: 76.94, TemperatureMin: 63.35, PrecipitationProbability: 59.6, Condition: ConditionShowers},
+			{Date: time.Date(2024, 9, 18, 16, 0, 0, 0, time.UTC), TemperatureMax: 78.3, TemperatureMin: 62.1, Condition: ConditionClear},
+		},
+	}
+
+	got := newWeatherMessage(weather, location, ProviderOpenWeather, time.Date(2024, 9, 17, 12, 2, 11, 0, time.UTC))
+	want := WeatherMessage{
+		SchemaVersion: 1,
+		Location:      "s81",
+		Timezone:      "America/New_York",
+		Provider:      ProviderOpenWeather,
+		GeneratedAt:   "2024-09-17T08:02:11-04:00",
+		Units:         WeatherUnits{Temperature: "°F", WindSpeed: "mph", Probability: "%"},
+		Current: CurrentMessage{
+			Time: "2024-09-17T08:00:00-04:00", Temperature: 72.5, FeelsLike: 73.1, WindSpeed: 8.1,
+			Condition: ConditionCloudy, Description: "scattered clouds", IsDay: true,
+		},
+		Daily: []DailyMessage{
+			{Date: "2024-09-17", TemperatureMax: 76.9, TemperatureMin: 63.4, PrecipitationProbability: 60, Condition: ConditionShowers},
+			{Date: "2024-09-18", TemperatureMax: 78.3, TemperatureMin: 62.1, PrecipitationProbability: 0, Condition: ConditionClear},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("newWeatherMessage() = %+v, want %+v", got, want)
+	}
+}
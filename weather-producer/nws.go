@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultNWSURL is the base URL of the National Weather Service API, which only covers the United States
+const defaultNWSURL = "https://api.weather.gov"
+
+// NWSProvider fetches the weather from the National Weather Service gridpoint forecasts
+type NWSProvider struct {
+	client  *http.Client
+	baseURL string
+
+	mu     sync.Mutex
+	points map[string]nwsPoints
+}
+
+// nwsPoints holds the forecast URLs the points endpoint returns for a location
+type nwsPoints struct {
+	Properties struct {
+		Forecast       string `json:"forecast"`
+		ForecastHourly string `json:"forecastHourly"`
+	} `json:"properties"`
+}
+
+// nwsValue is a quantitative value, which is null when the forecast has no data
+type nwsValue struct {
+	Value *float64 `json:"value"`
+}
+
+// nwsPeriod is a single period of a forecast, either an hour or half a day
+type nwsPeriod struct {
+	StartTime                  time.Time `json:"startTime"`
+	IsDaytime                  bool      `json:"isDaytime"`
+	Temperature                float64   `json:"temperature"`
+	ProbabilityOfPrecipitation nwsValue  `json:"probabilityOfPrecipitation"`
+	RelativeHumidity           nwsValue  `json:"relativeHumidity"`
+	WindSpeed                  string    `json:"windSpeed"`
+	WindDirection              string    `json:"windDirection"`
+	Icon                       string    `json:"icon"`
+	ShortForecast              string    `json:"shortForecast"`
+}
+
+// nwsForecast is the response of the forecast and hourly forecast endpoints
+type nwsForecast struct {
+	Properties struct {
+		Periods []nwsPeriod `json:"periods"`
+	} `json:"properties"`
+}
+
+// newNWSProvider creates a National Weather Service provider, using the public API if baseURL is empty
+func newNWSProvider(client *http.Client, baseURL string) *NWSProvider {
+	if baseURL == "" {
+		baseURL = defaultNWSURL
+	}
+	return &NWSProvider{client: client, baseURL: strings.TrimSuffix(baseURL, "/"), points: make(map[string]nwsPoints)}
+}
+
+// Name returns the provider name
+func (p *NWSProvider) Name() string {
+	return ProviderNWS
+}
+
+// Fetch looks up the forecast URLs for a location, then fetches the daily and hourly forecasts
+func (p *NWSProvider) Fetch(ctx context.Context, location LocationConfig) (*Weather, error) {
+	points, err := p.lookupPoints(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("units", "us")
+	if location.Units == "metric" {
+		query.Set("units", "si")
+	}
+
+	var hourly nwsForecast
+	err = fetchJSON(ctx, p.client, points.Properties.ForecastHourly+"?"+query.Encode(), []string{"properties"}, &hourly)
+	if err != nil {
+		return nil, err
+	}
+	var daily nwsForecast
+	err = fetchJSON(ctx, p.client, points.Properties.Forecast+"?"+query.Encode(), []string{"properties"}, &daily)
+	if err != nil {
+		return nil, err
+	}
+
+	return newNWSWeather(hourly.Properties.Periods, daily.Properties.Periods, location.Units == "metric"), nil
+}
+
+// lookupPoints returns the forecast URLs for a location, which are cached since they do not change
+func (p *NWSProvider) lookupPoints(ctx context.Context, location LocationConfig) (nwsPoints, error) {
+	p.mu.Lock()
+	points, ok := p.points[location.Name]
+	p.mu.Unlock()
+	if ok {
+		return points, nil
+	}
+
+	pointsURL := p.baseURL + "/points/" +
+		strconv.FormatFloat(location.Lat, 'f', 4, 64) + "," + strconv.FormatFloat(location.Lon, 'f', 4, 64)
+	if err := fetchJSON(ctx, p.client, pointsURL, []string{"properties"}, &points); err != nil {
+		return points, err
+	}
+	if points.Properties.Forecast == "" || points.Properties.ForecastHourly == "" {
+		return points, &RejectedPayloadError{Reason: "points response has no forecast URLs", StatusCode: http.StatusOK}
+	}
+
+	p.mu.Lock()
+	p.points[location.Name] = points
+	p.mu.Unlock()
+	return points, nil
+}
+
+// newNWSWeather maps the hourly and daily forecast periods into the canonical model.
+// The forecasts carry no observations, so the current weather is taken from the first hourly period.
+func newNWSWeather(hourly []nwsPeriod, daily []nwsPeriod, metric bool) *Weather {
+	weather := &Weather{
+		Minutely: []MinutelyWeather{},
+		Hourly:   []HourlyWeather{},
+		Daily:    []DailyWeather{},
+		Alerts:   []WeatherAlert{},
+	}
+
+	if len(hourly) > 0 {
+		current := hourly[0]
+		weather.Current = CurrentWeather{
+			Time:          current.StartTime,
+			Temperature:   current.Temperature,
+			FeelsLike:     current.Temperature,
+			Humidity:      current.RelativeHumidity.value(),
+			WindSpeed:     nwsWindSpeed(current.WindSpeed, metric),
+			WindDirection: compassDegrees[current.WindDirection],
+			Condition:     nwsIconCondition(current.Icon),
+			Description:   current.ShortForecast,
+			IsDay:         current.IsDaytime,
+		}
+	}
+
+	for _, hour := range hourly {
+		if len(weather.Hourly) == maxHourly {
+			break
+		}
+		weather.Hourly = append(weather.Hourly, HourlyWeather{
+			Time:                     hour.StartTime,
+			Temperature:              hour.Temperature,
+			PrecipitationProbability: hour.ProbabilityOfPrecipitation.value(),
+			Condition:                nwsIconCondition(hour.Icon),
+		})
+	}
+
+	// Daily periods alternate between day and night, a night is folded into the day before it
+	for _, period := range daily {
+		if !period.IsDaytime && len(weather.Daily) > 0 {
+			day := &weather.Daily[len(weather.Daily)-1]
+			day.TemperatureMin = period.Temperature
+			if probability := period.ProbabilityOfPrecipitation.value(); probability > day.PrecipitationProbability {
+				day.PrecipitationProbability = probability
+			}
+			continue
+		}
+		if len(weather.Daily) == maxDaily {
+			break
+		}
+		weather.Daily = append(weather.Daily, DailyWeather{
+			Date:                     period.StartTime,
+			TemperatureMax:           period.Temperature,
+			TemperatureMin:           period.Temperature,
+			PrecipitationProbability: period.ProbabilityOfPrecipitation.value(),
+			Condition:                nwsIconCondition(period.Icon),
+			Description:              period.ShortForecast,
+		})
+	}
+
+	return weather
+}
+
+// value returns the value, or zero if it is null
+func (v nwsValue) value() float64 {
+	return valueOrZero(v.Value)
+}
+
+// nwsWindSpeed parses a wind speed such as "10 mph" or "5 to 10 km/h", taking the upper bound of a range.
+// Metric speeds are converted from km/h to m/s.
+func nwsWindSpeed(windSpeed string, metric bool) float64 {
+	fields := strings.Fields(windSpeed)
+	var speed float64
+	for _, field := range fields {
+		if value, err := strconv.ParseFloat(field, 64); err == nil {
+			speed = value
+		}
+	}
+	if metric {
+		return speed / 3.6
+	}
+	return speed
+}
+
+// compassDegrees maps the compass points used for wind directions to degrees
+var compassDegrees = map[string]float64{
+	"N": 0, "NNE": 22.5, "NE": 45, "ENE": 67.5,
+	"E": 90, "ESE": 112.5, "SE": 135, "SSE": 157.5,
+	"S": 180, "SSW": 202.5, "SW": 225, "WSW": 247.5,
+	"W": 270, "WNW": 292.5, "NW": 315, "NNW": 337.5,
+}
+
+// nwsIconCondition maps an icon URL such as https://api.weather.gov/icons/land/day/tsra_sct,40?size=medium
+// to a condition. When the URL names two conditions, the first one is used.
+func nwsIconCondition(icon string) Condition {
+	iconURL, err := url.Parse(icon)
+	if err != nil {
+		return ConditionPartlyCloudy
+	}
+
+	segments := strings.Split(strings.Trim(iconURL.Path, "/"), "/")
+	var token string
+	for i, segment := range segments {
+		if (segment == "day" || segment == "night") && i+1 < len(segments) {
+			token, _, _ = strings.Cut(segments[i+1], ",")
+			break
+		}
+	}
+	token = strings.TrimPrefix(token, "wind_")
+
+	switch {
+	case token == "skc" || token == "few" || token == "hot" || token == "cold":
+		return ConditionClear
+	case token == "sct":
+		return ConditionPartlyCloudy
+	case token == "bkn" || token == "ovc":
+		return ConditionCloudy
+	case strings.HasPrefix(token, "tsra") || token == "tornado" || token == "hurricane" || token == "tropical_storm":
+		return ConditionThunderstorm
+	case strings.Contains(token, "snow") || token == "blizzard":
+		return ConditionSnow
+	case strings.HasPrefix(token, "rain_showers"):
+		return ConditionShowers
+	case strings.Contains(token, "rain") || strings.Contains(token, "sleet") || token == "fzra":
+		return ConditionRain
+	case token == "fog" || token == "haze" || token == "smoke" || token == "dust":
+		return ConditionFog
+	default:
+		return ConditionPartlyCloudy
+	}
+}
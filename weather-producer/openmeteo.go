@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultOpenMeteoURL is the base URL of the Open-Meteo forecast API
+const defaultOpenMeteoURL = "https://api.open-meteo.com"
+
+// OpenMeteoProvider fetches the weather from the Open-Meteo forecast API, which needs no API key
+type OpenMeteoProvider struct {
+	client  *http.Client
+	baseURL string
+}
+
+// openMeteoResponse holds the forecast variables requested from Open-Meteo, with Unix timestamps.
+// Probabilities are pointers because Open-Meteo returns null where a model has no data.
+type openMeteoResponse struct {
+	Current struct {
+		Time                int64   `json:"time"`
+		Temperature         float64 `json:"temperature_2m"`
+		ApparentTemperature float64 `json:"apparent_temperature"`
+		RelativeHumidity    float64 `json:"relative_humidity_2m"`
+		IsDay               int     `json:"is_day"`
+		WeatherCode         int     `json:"weather_code"`
+		WindSpeed           float64 `json:"wind_speed_10m"`
+		WindDirection       float64 `json:"wind_direction_10m"`
+	} `json:"current"`
+	Minutely15 struct {
+		Time          []int64    `json:"time"`
+		Precipitation []*float64 `json:"precipitation"`
+	} `json:"minutely_15"`
+	Hourly struct {
+		Time                     []int64    `json:"time"`
+		Temperature              []float64  `json:"temperature_2m"`
+		PrecipitationProbability []*float64 `json:"precipitation_probability"`
+		WeatherCode              []int      `json:"weather_code"`
+	} `json:"hourly"`
+	Daily struct {
+		Time                        []int64    `json:"time"`
+		WeatherCode                 []int      `json:"weather_code"`
+		TemperatureMax              []float64  `json:"temperature_2m_max"`
+		TemperatureMin              []float64  `json:"temperature_2m_min"`
+		PrecipitationProbabilityMax []*float64 `json:"precipitation_probability_max"`
+		Sunrise                     []int64    `json:"sunrise"`
+		Sunset                      []int64    `json:"sunset"`
+	} `json:"daily"`
+}
+
+// newOpenMeteoProvider creates an Open-Meteo provider, using the public API if baseURL is empty
+func newOpenMeteoProvider(client *http.Client, baseURL string) *OpenMeteoProvider {
+	if baseURL == "" {
+		baseURL = defaultOpenMeteoURL
+	}
+	return &OpenMeteoProvider{client: client, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// Name returns the provider name
+func (p *OpenMeteoProvider) Name() string {
+	return ProviderOpenMeteo
+}
+
+// Fetch fetches the current weather and forecasts for a location
+func (p *OpenMeteoProvider) Fetch(ctx context.Context, location LocationConfig) (*Weather, error) {
+	query := url.Values{}
+	query.Set("latitude", strconv.FormatFloat(location.Lat, 'f', -1, 64))
+	query.Set("longitude", strconv.FormatFloat(location.Lon, 'f', -1, 64))
+	query.Set("current", "temperature_2m,apparent_temperature,relative_humidity_2m,is_day,weather_code,wind_speed_10m,wind_direction_10m")
+	query.Set("minutely_15", "precipitation")
+	query.Set("hourly", "temperature_2m,precipitation_probability,weather_code")
+	query.Set("daily", "weather_code,temperature_2m_max,temperature_2m_min,precipitation_probability_max,sunrise,sunset")
+	query.Set("forecast_minutely_15", "4")
+	query.Set("forecast_hours", strconv.Itoa(maxHourly))
+	query.Set("forecast_days", strconv.Itoa(maxDaily))
+	query.Set("timeformat", "unixtime")
+	query.Set("timezone", "auto")
+	if location.Units == "imperial" {
+		query.Set("temperature_unit", "fahrenheit")
+		query.Set("wind_speed_unit", "mph")
+	} else {
+		query.Set("wind_speed_unit", "ms")
+	}
+
+	var response openMeteoResponse
+	err := fetchJSON(ctx, p.client, p.baseURL+"/v1/forecast?"+query.Encode(), []string{"current", "hourly", "daily"}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response.toWeather(), nil
+}
+
+// toWeather maps an Open-Meteo response into the canonical model
+func (r *openMeteoResponse) toWeather() *Weather {
+	weather := &Weather{
+		Current: CurrentWeather{
+			Time:          unixTime(r.Current.Time),
+			Temperature:   r.Current.Temperature,
+			FeelsLike:     r.Current.ApparentTemperature,
+			Humidity:      r.Current.RelativeHumidity,
+			WindSpeed:     r.Current.WindSpeed,
+			WindDirection: r.Current.WindDirection,
+			Condition:     wmoCondition(r.Current.WeatherCode),
+			IsDay:         r.Current.IsDay == 1,
+		},
+		Minutely: []MinutelyWeather{},
+		Hourly:   []HourlyWeather{},
+		Daily:    []DailyWeather{},
+		Alerts:   []WeatherAlert{},
+	}
+
+	// Precipitation is the sum over the preceding 15 minutes, scaled to an hourly rate
+	minutely := r.Minutely15
+	for i := 0; i < len(minutely.Time) && i < len(minutely.Precipitation); i++ {
+		weather.Minutely = append(weather.Minutely, MinutelyWeather{
+			Time:          unixTime(minutely.Time[i]),
+			Precipitation: valueOrZero(minutely.Precipitation[i]) * 4,
+		})
+	}
+
+	hourly := r.Hourly
+	for i := 0; i < len(hourly.Time) && len(weather.Hourly) < maxHourly; i++ {
+		if i >= len(hourly.Temperature) || i >= len(hourly.WeatherCode) {
+			break
+		}
+		var probability float64
+		if i < len(hourly.PrecipitationProbability) {
+			probability = valueOrZero(hourly.PrecipitationProbability[i])
+		}
+		weather.Hourly = append(weather.Hourly, HourlyWeather{
+			Time:                     unixTime(hourly.Time[i]),
+			Temperature:              hourly.Temperature[i],
+			PrecipitationProbability: probability,
+			Condition:                wmoCondition(hourly.WeatherCode[i]),
+		})
+	}
+
+	daily := r.Daily
+	for i := 0; i < len(daily.Time) && len(weather.Daily) < maxDaily; i++ {
+		if i >= len(daily.TemperatureMax) || i >= len(daily.TemperatureMin) || i >= len(daily.WeatherCode) {
+			break
+		}
+		day := DailyWeather{
+			Date:           unixTime(daily.Time[i]),
+			TemperatureMax: daily.TemperatureMax[i],
+			TemperatureMin: daily.TemperatureMin[i],
+			Condition:      wmoCondition(daily.WeatherCode[i]),
+		}
+		if i < len(daily.PrecipitationProbabilityMax) {
+			day.PrecipitationProbability = valueOrZero(daily.PrecipitationProbabilityMax[i])
+		}
+		if i < len(daily.Sunrise) && i < len(daily.Sunset) {
+			sunrise, sunset := unixTime(daily.Sunrise[i]), unixTime(daily.Sunset[i])
+			day.Sunrise, day.Sunset = &sunrise, &sunset
+		}
+		weather.Daily = append(weather.Daily, day)
+	}
+
+	return weather
+}
+
+// valueOrZero returns the value, or zero if it is null
+func valueOrZero(value *float64) float64 {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
+
+// wmoCondition maps a WMO weather interpretation code to a condition
+func wmoCondition(code int) Condition {
+	switch {
+	case code <= 1:
+		return ConditionClear
+	case code == 2:
+		return ConditionPartlyCloudy
+	case code == 3:
+		return ConditionCloudy
+	case code == 45 || code == 48:
+		return ConditionFog
+	case code >= 51 && code <= 67:
+		return ConditionRain
+	case code >= 71 && code <= 77, code == 85, code == 86:
+		return ConditionSnow
+	case code >= 80 && code <= 82:
+		return ConditionShowers
+	case code >= 95:
+		return ConditionThunderstorm
+	default:
+		return ConditionCloudy
+	}
+}
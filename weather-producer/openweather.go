@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultOpenWeatherURL is the base URL of the OpenWeather One Call 3.0 API
+const defaultOpenWeatherURL = "https://api.openweathermap.org"
+
+// OpenWeatherProvider fetches the weather from the OpenWeather One Call 3.0 API
+type OpenWeatherProvider struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+}
+
+// openWeatherCondition is an entry of the weather array in a One Call response
+type openWeatherCondition struct {
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+}
+
+// openWeatherResponse holds the One Call fields mapped into the canonical model
+type openWeatherResponse struct {
+	Current struct {
+		Dt        int64                  `json:"dt"`
+		Temp      float64                `json:"temp"`
+		FeelsLike float64                `json:"feels_like"`
+		Humidity  float64                `json:"humidity"`
+		WindSpeed float64                `json:"wind_speed"`
+		WindDeg   float64                `json:"wind_deg"`
+		Weather   []openWeatherCondition `json:"weather"`
+	} `json:"current"`
+	Minutely []struct {
+		Dt            int64   `json:"dt"`
+		Precipitation float64 `json:"precipitation"`
+	} `json:"minutely"`
+	Hourly []struct {
+		Dt      int64                  `json:"dt"`
+		Temp    float64                `json:"temp"`
+		Pop     float64                `json:"pop"`
+		Weather []openWeatherCondition `json:"weather"`
+	} `json:"hourly"`
+	Daily []struct {
+		Dt      int64  `json:"dt"`
+		Sunrise int64  `json:"sunrise"`
+		Sunset  int64  `json:"sunset"`
+		Summary string `json:"summary"`
+		Temp    struct {
+			Min float64 `json:"min"`
+			Max float64 `json:"max"`
+		} `json:"temp"`
+		Pop     float64                `json:"pop"`
+		Weather []openWeatherCondition `json:"weather"`
+	} `json:"daily"`
+	Alerts []struct {
+		SenderName  string   `json:"sender_name"`
+		Event       string   `json:"event"`
+		Start       int64    `json:"start"`
+		End         int64    `json:"end"`
+		Description string   `json:"description"`
+		Tags        []string `json:"tags"`
+	} `json:"alerts"`
+}
+
+// newOpenWeatherProvider creates an OpenWeather provider, using the public API if baseURL is empty
+func newOpenWeatherProvider(client *http.Client, baseURL string, apiKey string) *OpenWeatherProvider {
+	if baseURL == "" {
+		baseURL = defaultOpenWeatherURL
+	}
+	return &OpenWeatherProvider{client: client, baseURL: strings.TrimSuffix(baseURL, "/"), apiKey: apiKey}
+}
+
+// Name returns the provider name
+func (p *OpenWeatherProvider) Name() string {
+	return ProviderOpenWeather
+}
+
+// Fetch fetches the One Call data for a location
+func (p *OpenWeatherProvider) Fetch(ctx context.Context, location LocationConfig) (*Weather, error) {
+	query := url.Values{}
+	query.Set("units", location.Units)
+	query.Set("lang", location.Lang)
+	query.Set("lat", strconv.FormatFloat(location.Lat, 'f', -1, 64))
+	query.Set("lon", strconv.FormatFloat(location.Lon, 'f', -1, 64))
+	query.Set("appid", p.apiKey)
+
+	var response openWeatherResponse
+	err := fetchJSON(ctx, p.client, p.baseURL+"/data/3.0/onecall?"+query.Encode(), []string{"current", "hourly", "daily"}, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response.toWeather(), nil
+}
+
+// toWeather maps a One Call response into the canonical model
+func (r *openWeatherResponse) toWeather() *Weather {
+	current := firstOpenWeatherCondition(r.Current.Weather)
+	weather := &Weather{
+		Current: CurrentWeather{
+			Time:          unixTime(r.Current.Dt),
+			Temperature:   r.Current.Temp,
+			FeelsLike:     r.Current.FeelsLike,
+			Humidity:      r.Current.Humidity,
+			WindSpeed:     r.Current.WindSpeed,
+			WindDirection: r.Current.WindDeg,
+			Condition:     openWeatherIconCondition(current.Icon),
+			Description:   current.Description,
+			IsDay:         !strings.HasSuffix(current.Icon, "n"),
+		},
+		Minutely: []MinutelyWeather{},
+		Hourly:   []HourlyWeather{},
+		Daily:    []DailyWeather{},
+		Alerts:   []WeatherAlert{},
+	}
+
+	for _, minute := range r.Minutely {
+		weather.Minutely = append(weather.Minutely, MinutelyWeather{
+			Time:          unixTime(minute.Dt),
+			Precipitation: minute.Precipitation,
+		})
+	}
+	for _, hour := range r.Hourly {
+		if len(weather.Hourly) == maxHourly {
+			break
+		}
+		weather.Hourly = append(weather.Hourly, HourlyWeather{
+			Time:                     unixTime(hour.Dt),
+			Temperature:              hour.Temp,
+			PrecipitationProbability: hour.Pop * 100,
+			Condition:                openWeatherIconCondition(firstOpenWeatherCondition(hour.Weather).Icon),
+		})
+	}
+	for _, day := range r.Daily {
+		if len(weather.Daily) == maxDaily {
+			break
+		}
+		sunrise, sunset := unixTime(day.Sunrise), unixTime(day.Sunset)
+		weather.Daily = append(weather.Daily, DailyWeather{
+			Date:                     unixTime(day.Dt),
+			TemperatureMax:           day.Temp.Max,
+			TemperatureMin:           day.Temp.Min,
+			PrecipitationProbability: day.Pop * 100,
+			Condition:                openWeatherIconCondition(firstOpenWeatherCondition(day.Weather).Icon),
+			Description:              day.Summary,
+			Sunrise:                  &sunrise,
+			Sunset:                   &sunset,
+		})
+	}
+	for _, alert := range r.Alerts {
+		tags := alert.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		weather.Alerts = append(weather.Alerts, WeatherAlert{
+			Sender:      alert.SenderName,
+			Event:       alert.Event,
+			Start:       unixTime(alert.Start),
+			End:         unixTime(alert.End),
+			Description: alert.Description,
+			Tags:        tags,
+		})
+	}
+
+	return weather
+}
+
+// firstOpenWeatherCondition returns the primary condition, or an empty one if there is none
+func firstOpenWeatherCondition(conditions []openWeatherCondition) openWeatherCondition {
+	if len(conditions) == 0 {
+		return openWeatherCondition{}
+	}
+	return conditions[0]
+}
+
+// openWeatherIconCondition maps an OpenWeather icon code such as "10d" to a condition
+func openWeatherIconCondition(icon string) Condition {
+	switch strings.TrimRight(icon, "dn") {
+	case "01":
+		return ConditionClear
+	case "03", "04":
+		return ConditionCloudy
+	case "09":
+		return ConditionRain
+	case "10":
+		return ConditionShowers
+	case "11":
+		return ConditionThunderstorm
+	case "13":
+		return ConditionSnow
+	case "50":
+		return ConditionFog
+	default:
+		return ConditionPartlyCloudy
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	defaultPollInterval = 10 * time.Minute // Default time between successful fetches.
+	defaultMaxBackoff   = time.Hour        // Default upper bound for the retry delay.
+	baseBackoff         = 30 * time.Second // Delay after the first failed fetch, doubled on each further failure.
+)
+
+// PollConfig holds the timing and topic settings shared by all pollers
+type PollConfig struct {
+	Interval        time.Duration
+	MaxBackoff      time.Duration
+	StatusTopic     string
+	AlertsTopic     string
+	DeadLetterTopic string
+}
+
+// loadPollConfig reads the poll settings from WEATHER_POLL_INTERVAL, WEATHER_MAX_BACKOFF,
+// WEATHER_STATUS_TOPIC, WEATHER_ALERTS_TOPIC and WEATHER_DEAD_LETTER_TOPIC
+func loadPollConfig() (PollConfig, error) {
+	config := PollConfig{
+		Interval:        defaultPollInterval,
+		MaxBackoff:      defaultMaxBackoff,
+		StatusTopic:     "weather-status",
+		AlertsTopic:     "weather-alerts",
+		DeadLetterTopic: "weather-dead-letter",
+	}
+
+	if env := os.Getenv("WEATHER_POLL_INTERVAL"); env != "" {
+		interval, err := time.ParseDuration(env)
+		if err != nil || interval <= 0 {
+			return config, fmt.Errorf("WEATHER_POLL_INTERVAL must be a positive duration, got %q", env)
+		}
+		config.Interval = interval
+	}
+	if env := os.Getenv("WEATHER_MAX_BACKOFF"); env != "" {
+		maxBackoff, err := time.ParseDuration(env)
+		if err != nil || maxBackoff <= 0 {
+			return config, fmt.Errorf("WEATHER_MAX_BACKOFF must be a positive duration, got %q", env)
+		}
+		config.MaxBackoff = maxBackoff
+	}
+	if env := os.Getenv("WEATHER_STATUS_TOPIC"); env != "" {
+		config.StatusTopic = env
+	}
+	if env := os.Getenv("WEATHER_ALERTS_TOPIC"); env != "" {
+		config.AlertsTopic = env
+	}
+	if env := os.Getenv("WEATHER_DEAD_LETTER_TOPIC"); env != "" {
+		config.DeadLetterTopic = env
+	}
+	return config, nil
+}
+
+// RetryableError is returned when the weather API is rate limiting or failing and the fetch should be retried later
+type RetryableError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	return fmt.Sprintf("weather API returned status %d", e.StatusCode)
+}
+
+// newRetryableError builds a RetryableError for 429 and 5xx responses, or returns nil for any other status
+func newRetryableError(res *http.Response) *RetryableError {
+	if res.StatusCode != http.StatusTooManyRequests && res.StatusCode < 500 {
+		return nil
+	}
+	return &RetryableError{
+		StatusCode: res.StatusCode,
+		RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// Location statuses published in LocationState
+const (
+	StatusOK      = "ok"
+	StatusFailing = "failing"
+)
+
+// Categories of failed fetches published in LocationState. The error itself is only logged, it can contain
+// upstream URLs and response details that must not reach clients.
+const (
+	ErrorRateLimited = "rate_limited"     // The provider answered 429
+	ErrorUnavailable = "unavailable"      // The provider answered 5xx
+	ErrorRejected    = "rejected_payload" // The response was unusable, see the dead-letter topic
+	ErrorTimeout     = "timeout"
+	ErrorNetwork     = "network"
+	ErrorOther       = "other"
+)
+
+// LocationState records the outcome of the fetches for a location
+type LocationState struct {
+	Location            string    `json:"location"`
+	Status              string    `json:"status"`
+	ErrorCategory       string    `json:"errorCategory,omitempty"`
+	LastAttempt         time.Time `json:"lastAttempt"`
+	LastSuccess         time.Time `json:"lastSuccess"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	NextPoll            time.Time `json:"nextPoll"`
+}
+
+// errorCategory classifies a failed fetch for the published state
+func errorCategory(err error) string {
+	var retryable *RetryableError
+	var rejected *RejectedPayloadError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &retryable):
+		if retryable.StatusCode == http.StatusTooManyRequests {
+			return ErrorRateLimited
+		}
+		return ErrorUnavailable
+	case errors.As(err, &rejected):
+		return ErrorRejected
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorTimeout
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return ErrorTimeout
+		}
+		return ErrorNetwork
+	default:
+		return ErrorOther
+	}
+}
+
+// Poller fetches the weather for a single location on an interval, backing off while the API is failing
+type Poller struct {
+	writer   *kafka.Writer
+	provider WeatherProvider
+	location LocationConfig
+	config   PollConfig
+	alerts   *AlertTracker
+
+	mu    sync.RWMutex
+	state LocationState
+}
+
+// newPoller creates a poller for the location
+func newPoller(writer *kafka.Writer, provider WeatherProvider, location LocationConfig, config PollConfig) *Poller {
+	return &Poller{
+		writer:   writer,
+		provider: provider,
+		location: location,
+		config:   config,
+		alerts:   newAlertTracker(location.Name),
+		state:    LocationState{Location: location.Name},
+	}
+}
+
+// State returns a copy of the outcome of the fetches for the location
+func (p *Poller) State() LocationState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.state
+}
+
+// run polls until ctx is canceled, starting immediately
+func (p *Poller) run(ctx context.Context) {
+	for {
+		delay := p.poll(ctx)
+		// A poll aborted by shutdown returns no delay, don't poll again
+		if ctx.Err() != nil {
+			return
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// poll fetches and publishes once, records the outcome and returns the delay until the next poll
+func (p *Poller) poll(ctx context.Context) time.Duration {
+	now := time.Now()
+	weather, err := fetchAndPublishWeatherData(ctx, p.writer, p.provider, p.location)
+	// A fetch aborted by shutdown says nothing about the provider, so it is not recorded
+	if err != nil && ctx.Err() != nil {
+		return 0
+	}
+	if err == nil {
+		p.publishAlerts(weather.Alerts, now)
+	}
+
+	var rejected *RejectedPayloadError
+	if errors.As(err, &rejected) {
+		if err := publishDeadLetter(p.writer, p.config.DeadLetterTopic, p.location.Name, rejected); err != nil {
+			slog.Error("Error writing dead letter to Kafka", "location", p.location.Name, "topic", p.config.DeadLetterTopic, "error", err)
+		}
+	}
+
+	state, delay := p.record(err, now)
+	p.publishState(state)
+	return delay
+}
+
+// record updates the state with the outcome of a poll and returns it along with the delay until the next poll
+func (p *Poller) record(err error, now time.Time) (LocationState, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.state.LastAttempt = now
+	var delay time.Duration
+	if err != nil {
+		p.state.Status = StatusFailing
+		p.state.ErrorCategory = errorCategory(err)
+		p.state.ConsecutiveFailures++
+		delay = p.retryDelay(err, p.state.ConsecutiveFailures)
+		slog.Error("Error updating weather data", "location", p.location.Name, "retry_in", delay.Round(time.Second).String(),
+			"failures", p.state.ConsecutiveFailures, "error", err)
+	} else {
+		p.state.Status = StatusOK
+		p.state.ErrorCategory = ""
+		p.state.LastSuccess = now
+		p.state.ConsecutiveFailures = 0
+		delay = p.config.Interval
+	}
+	p.state.NextPoll = now.Add(delay)
+	return p.state, delay
+}
+
+// retryDelay returns how long to wait after a failed fetch. Rate limiting and server errors back off
+// exponentially with jitter, honoring Retry-After, anything else waits for the regular interval.
+func (p *Poller) retryDelay(err error, failures int) time.Duration {
+	var retryable *RetryableError
+	if !errors.As(err, &retryable) {
+		return p.config.Interval
+	}
+
+	delay := backoff(failures, p.config.MaxBackoff)
+	if retryable.RetryAfter > delay {
+		delay = retryable.RetryAfter
+	}
+	return delay
+}
+
+// backoff returns an exponential delay for the number of failures, capped at max, with jitter in its upper half
+func backoff(failures int, max time.Duration) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < failures && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// publishState publishes the poller state so dashboards can show when the weather was last updated
+func (p *Poller) publishState(state LocationState) {
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		slog.Error("Error marshaling weather state", "location", p.location.Name, "error", err)
+		return
+	}
+
+	err = p.writer.WriteMessages(context.Background(),
+		kafka.Message{
+			Topic: p.config.StatusTopic,
+			Key:   []byte(p.location.Key),
+			Value: stateJSON,
+		},
+	)
+	if err != nil {
+		slog.Error("Error writing weather state to Kafka", "location", p.location.Name, "topic", p.config.StatusTopic, "error", err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPublishedStateOmitsAPIKey(t *testing.T) {
+	// Reserve a port and close it, so the fetch fails with a connection error naming the request URL
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := "http://" + listener.Addr().String()
+	listener.Close()
+
+	const apiKey = "SECRET-API-KEY"
+	provider := newOpenWeatherProvider(&http.Client{Timeout: time.Second}, unreachable, apiKey)
+	_, fetchErr := provider.Fetch(context.Background(), s81)
+	if fetchErr == nil {
+		t.Fatal("expected the fetch from an unreachable host to fail")
+	}
+	if strings.Contains(fetchErr.Error(), apiKey) {
+		t.Errorf("fetch error contains the API key: %v", fetchErr)
+	}
+
+	poller := newPoller(nil, provider, s81, PollConfig{Interval: time.Minute, MaxBackoff: time.Hour})
+	state, _ := poller.record(fetchErr, time.Now())
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(stateJSON), apiKey) || strings.Contains(string(stateJSON), unreachable) {
+		t.Errorf("published state leaks the request: %s", stateJSON)
+	}
+	if state.Status != StatusFailing || state.ErrorCategory != ErrorNetwork {
+		t.Errorf("got status %q category %q, want %q and %q", state.Status, state.ErrorCategory, StatusFailing, ErrorNetwork)
+	}
+}
+
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&RetryableError{StatusCode: http.StatusTooManyRequests}, ErrorRateLimited},
+		{&RetryableError{StatusCode: http.StatusBadGateway}, ErrorUnavailable},
+		{&RejectedPayloadError{Reason: "unexpected status 401", StatusCode: http.StatusUnauthorized}, ErrorRejected},
+		{context.DeadlineExceeded, ErrorTimeout},
+		{json.Unmarshal([]byte("{"), &struct{}{}), ErrorOther},
+	}
+	for _, test := range tests {
+		if got := errorCategory(test.err); got != test.want {
+			t.Errorf("errorCategory(%v) = %q, want %q", test.err, got, test.want)
+		}
+	}
+}
+
+// blockingProvider fails every fetch once ctx is canceled and counts the fetches
+type blockingProvider struct {
+	fetches atomic.Int32
+}
+
+func (p *blockingProvider) Name() string { return "blocking" }
+
+func (p *blockingProvider) Fetch(ctx context.Context, location LocationConfig) (*Weather, error) {
+	p.fetches.Add(1)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestRunStopsWhenCanceled(t *testing.T) {
+	provider := &blockingProvider{}
+	poller := newPoller(nil, provider, s81, PollConfig{Interval: time.Minute, MaxBackoff: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		poller.run(ctx)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("run did not return after ctx was canceled")
+	}
+	if n := provider.fetches.Load(); n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Supported weather providers
+const (
+	ProviderOpenWeather = "openweather"
+	ProviderNWS         = "nws"
+	ProviderOpenMeteo   = "open-meteo"
+)
+
+// userAgent identifies the producer to upstream APIs, the National Weather Service requires one
+const userAgent = "s81-weather-producer (github.com/michael-hauser/s81)"
+
+// WeatherProvider fetches the weather for a location from an upstream API and maps it into the canonical model
+type WeatherProvider interface {
+	Name() string
+	Fetch(ctx context.Context, location LocationConfig) (*Weather, error)
+}
+
+// newProvider creates the provider selected in the configuration
+func newProvider(config *Config, apiKey string) (WeatherProvider, error) {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	switch config.Provider {
+	case ProviderOpenWeather:
+		return newOpenWeatherProvider(client, config.ProviderURL, apiKey), nil
+	case ProviderNWS:
+		return newNWSProvider(client, config.ProviderURL), nil
+	case ProviderOpenMeteo:
+		return newOpenMeteoProvider(client, config.ProviderURL), nil
+	default:
+		return nil, fmt.Errorf("unknown weather provider %q", config.Provider)
+	}
+}
+
+// fetchJSON requests a URL and decodes the JSON response into v. Rate limiting and server errors are returned
+// as a RetryableError, any other unusable response as a RejectedPayloadError.
+func fetchJSON(ctx context.Context, client *http.Client, url string, requiredFields []string, v any) (err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	// The query is left out of the span, it can hold the API key
+	ctx, span := tracer.Start(ctx, "fetch weather", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("server.address", req.URL.Host), attribute.String("url.path", req.URL.Path)))
+	defer func() { endSpan(span, err) }()
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return withoutQuery(err)
+	}
+	defer res.Body.Close()
+
+	if retryable := newRetryableError(res); retryable != nil {
+		return retryable
+	}
+
+	body, err := readResponse(res, maxWeatherSize)
+	if err != nil {
+		return err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", res.StatusCode), attribute.Int("s81.response.size", len(body)))
+	_, decodeSpan := tracer.Start(ctx, "decode weather")
+	defer decodeSpan.End()
+
+	reject := func(err error) error {
+		return &RejectedPayloadError{
+			Reason:     err.Error(),
+			StatusCode: res.StatusCode,
+			Body:       body,
+		}
+	}
+	if err := requireFields(body, requiredFields); err != nil {
+		return reject(err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return reject(fmt.Errorf("decoding response: %w", err))
+	}
+	return nil
+}
+
+// withoutQuery drops the query from the URL of a failed request, since it can hold the API key
+func withoutQuery(err error) error {
+	var urlErr *neturl.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	requestURL, parseErr := neturl.Parse(urlErr.URL)
+	if parseErr != nil {
+		return &neturl.Error{Op: urlErr.Op, URL: "[REDACTED]", Err: urlErr.Err}
+	}
+	requestURL.RawQuery = ""
+	return &neturl.Error{Op: urlErr.Op, URL: requestURL.String(), Err: urlErr.Err}
+}
+
+// requireFields checks that the body is a JSON object containing every required field
+func requireFields(body []byte, requiredFields []string) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	for _, field := range requiredFields {
+		value, ok := fields[field]
+		if !ok || string(value) == "null" {
+			return fmt.Errorf("missing required field %q", field)
+		}
+	}
+	return nil
+}
+
+// unixTime converts a Unix timestamp into a UTC time
+func unixTime(seconds int64) time.Time {
+	return time.Unix(seconds, 0).UTC()
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// s81 is the default location, fetched in imperial units
+var s81 = LocationConfig{Name: "s81", Lat: 40.781433, Lon: -73.972143, Timezone: "America/New_York", Units: "imperial", Lang: "en", Topic: "weather-data", Key: "weather"}
+
+// readFixture reads a provider response from testdata
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatalf("reading fixture %s: %v", name, err)
+	}
+	return data
+}
+
+// assertWeather compares the JSON encoding of the weather, so times are compared including their offset
+func assertWeather(t *testing.T, got *Weather, want *Weather) {
+	t.Helper()
+
+	gotJSON, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatalf("marshaling weather: %v", err)
+	}
+	wantJSON, err := json.MarshalIndent(want, "", "  ")
+	if err != nil {
+		t.Fatalf("marshaling expected weather: %v", err)
+	}
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("weather mismatch\ngot:  %s\nwant: %s", gotJSON, wantJSON)
+	}
+}
+
+// timePointer returns a pointer to a Unix time, for the optional sunrise and sunset fields
+func timePointer(seconds int64) *time.Time {
+	t := unixTime(seconds)
+	return &t
+}
+
+func TestOpenWeatherProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/data/3.0/onecall" || query.Get("appid") != "test-key" || query.Get("units") != "imperial" ||
+			query.Get("lat") != "40.781433" || query.Get("lon") != "-73.972143" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write(readFixture(t, "openweather.json"))
+	}))
+	defer server.Close()
+
+	provider := newOpenWeatherProvider(server.Client(), server.URL, "test-key")
+	weather, err := provider.Fetch(context.Background(), s81)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	assertWeather(t, weather, &Weather{
+		Current: CurrentWeather{
+			Time: unixTime(1726574400), Temperature: 72.5, FeelsLike: 73.1, Humidity: 64, WindSpeed: 8.05, WindDirection: 220,
+			Condition: ConditionCloudy, Description: "scattered clouds", IsDay: true,
+		},
+		Minutely: []MinutelyWeather{
+			{Time: unixTime(1726574400), Precipitation: 0},
+			{Time: unixTime(1726574460), Precipitation: 0.21},
+		},
+		Hourly: []HourlyWeather{
+			{Time: unixTime(1726574400), Temperature: 72.5, PrecipitationProbability: 0, Condition: ConditionCloudy},
+			{Time: unixTime(1726578000), Temperature: 71.2, PrecipitationProbability: 35, Condition: ConditionShowers},
+			{Time: unixTime(1726581600), Temperature: 69.8, PrecipitationProbability: 60, Condition: ConditionThunderstorm},
+		},
+		Daily: []DailyWeather{
+			{
+				Date: unixTime(1726560000), TemperatureMax: 76.9, TemperatureMin: 63.4, PrecipitationProbability: 60,
+				Condition: ConditionShowers, Description: "Expect a day of partly cloudy with rain",
+				Sunrise: timePointer(1726569052), Sunset: timePointer(1726613896),
+			},
+			{
+				Date: unixTime(1726646400), TemperatureMax: 78.3, TemperatureMin: 62.1, PrecipitationProbability: 0,
+				Condition: ConditionClear, Description: "There will be clear sky today",
+				Sunrise: timePointer(1726655512), Sunset: timePointer(1726700190),
+			},
+		},
+		Alerts: []WeatherAlert{
+			{
+				Sender: "NWS New York City - Upton NY", Event: "Heat Advisory", Start: unixTime(1726567200), End: unixTime(1726614000),
+				Description: "Heat index values up to 100 expected.", Tags: []string{"Extreme temperature value"},
+			},
+		},
+	})
+}
+
+func TestNWSProvider(t *testing.T) {
+	var pointsRequests int
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") == "" {
+			t.Errorf("request %s has no User-Agent", r.URL)
+		}
+		switch {
+		case r.URL.Path == "/points/40.7814,-73.9721":
+			pointsRequests++
+			w.Write([]byte(strings.ReplaceAll(string(readFixture(t, "nws-points.json")), "{{baseURL}}", server.URL)))
+		case r.URL.Path == "/gridpoints/OKX/33,37/forecast/hourly" && r.URL.Query().Get("units") == "us":
+			w.Write(readFixture(t, "nws-forecast-hourly.json"))
+		case r.URL.Path == "/gridpoints/OKX/33,37/forecast" && r.URL.Query().Get("units") == "us":
+			w.Write(readFixture(t, "nws-forecast.json"))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider := newNWSProvider(server.Client(), server.URL)
+	for i := 0; i < 2; i++ {
+		weather, err := provider.Fetch(context.Background(), s81)
+		if err != nil {
+			t.Fatalf("Fetch() error = %v", err)
+		}
+
+		eastern := time.FixedZone("", -4*60*60)
+		assertWeather(t, weather, &Weather{
+			Current: CurrentWeather{
+				Time: time.Date(2024, 9, 17, 8, 0, 0, 0, eastern), Temperature: 72, FeelsLike: 72, Humidity: 64, WindSpeed: 8, WindDirection: 225,
+				Condition: ConditionPartlyCloudy, Description: "Partly Sunny", IsDay: true,
+			},
+			Minutely: []MinutelyWeather{},
+			Hourly: []HourlyWeather{
+				{Time: time.Date(2024, 9, 17, 8, 0, 0, 0, eastern), Temperature: 72, PrecipitationProbability: 0, Condition: ConditionPartlyCloudy},
+				{Time: time.Date(2024, 9, 17, 9, 0, 0, 0, eastern), Temperature: 71, PrecipitationProbability: 35, Condition: ConditionShowers},
+			},
+			Daily: []DailyWeather{
+				{
+					Date: time.Date(2024, 9, 17, 6, 0, 0, 0, eastern), TemperatureMax: 77, TemperatureMin: 63, PrecipitationProbability: 60,
+					Condition: ConditionThunderstorm, Description: "Chance Showers And Thunderstorms then Partly Sunny",
+				},
+				{
+					Date: time.Date(2024, 9, 18, 6, 0, 0, 0, eastern), TemperatureMax: 78, TemperatureMin: 78, PrecipitationProbability: 0,
+					Condition: ConditionClear, Description: "Sunny",
+				},
+			},
+			Alerts: []WeatherAlert{},
+		})
+	}
+
+	if pointsRequests != 1 {
+		t.Errorf("points requested %d times, want 1", pointsRequests)
+	}
+}
+
+func TestOpenMeteoProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/v1/forecast" || query.Get("temperature_unit") != "fahrenheit" || query.Get("wind_speed_unit") != "mph" ||
+			query.Get("timeformat") != "unixtime" || query.Get("latitude") != "40.781433" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		w.Write(readFixture(t, "open-meteo.json"))
+	}))
+	defer server.Close()
+
+	provider := newOpenMeteoProvider(server.Client(), server.URL)
+	weather, err := provider.Fetch(context.Background(), s81)
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	assertWeather(t, weather, &Weather{
+		Current: CurrentWeather{
+			Time: unixTime(1726574400), Temperature: 72.5, FeelsLike: 73.1, Humidity: 64, WindSpeed: 8.1, WindDirection: 220,
+			Condition: ConditionPartlyCloudy, IsDay: true,
+		},
+		Minutely: []MinutelyWeather{
+			{Time: unixTime(1726574400), Precipitation: 0},
+			{Time: unixTime(1726575300), Precipitation: 0.4},
+		},
+		Hourly: []HourlyWeather{
+			{Time: unixTime(1726574400), Temperature: 72.5, PrecipitationProbability: 0, Condition: ConditionPartlyCloudy},
+			{Time: unixTime(1726578000), Temperature: 71.2, PrecipitationProbability: 35, Condition: ConditionRain},
+			{Time: unixTime(1726581600), Temperature: 69.8, PrecipitationProbability: 0, Condition: ConditionThunderstorm},
+		},
+		Daily: []DailyWeather{
+			{
+				Date: unixTime(1726545600), TemperatureMax: 76.9, TemperatureMin: 63.4, PrecipitationProbability: 60,
+				Condition: ConditionRain, Sunrise: timePointer(1726569052), Sunset: timePointer(1726613896),
+			},
+			{
+				Date: unixTime(1726632000), TemperatureMax: 78.3, TemperatureMin: 62.1, PrecipitationProbability: 0,
+				Condition: ConditionClear, Sunrise: timePointer(1726655512), Sunset: timePointer(1726700190),
+			},
+		},
+		Alerts: []WeatherAlert{},
+	})
+}
+
+func TestProviderErrors(t *testing.T) {
+	providers := map[string]func(client *http.Client, baseURL string) WeatherProvider{
+		ProviderOpenWeather: func(client *http.Client, baseURL string) WeatherProvider {
+			return newOpenWeatherProvider(client, baseURL, "test-key")
+		},
+		ProviderNWS: func(client *http.Client, baseURL string) WeatherProvider {
+			return newNWSProvider(client, baseURL)
+		},
+		ProviderOpenMeteo: func(client *http.Client, baseURL string) WeatherProvider {
+			return newOpenMeteoProvider(client, baseURL)
+		},
+	}
+
+	tests := []struct {
+		name           string
+		status         int
+		header         http.Header
+		body           string
+		wantRetryAfter time.Duration // Expected RetryAfter of a RetryableError.
+		wantRetryable  bool
+		wantRejected   bool
+	}{
+		{
+			name:           "rate limited",
+			status:         http.StatusTooManyRequests,
+			header:         http.Header{"Retry-After": []string{"120"}},
+			wantRetryable:  true,
+			wantRetryAfter: 2 * time.Minute,
+		},
+		{
+			name:          "server error",
+			status:        http.StatusServiceUnavailable,
+			wantRetryable: true,
+		},
+		{
+			name:         "unauthorized",
+			status:       http.StatusUnauthorized,
+			body:         `{"cod":401,"message":"Invalid API key"}`,
+			wantRejected: true,
+		},
+		{
+			name:         "invalid JSON",
+			status:       http.StatusOK,
+			body:         `<html>maintenance</html>`,
+			wantRejected: true,
+		},
+		{
+			name:         "missing fields",
+			status:       http.StatusOK,
+			body:         `{"hourly":null}`,
+			wantRejected: true,
+		},
+	}
+
+	for providerName, newTestProvider := range providers {
+		for _, tt := range tests {
+			t.Run(providerName+"/"+tt.name, func(t *testing.T) {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					for key, values := range tt.header {
+						w.Header()[key] = values
+					}
+					w.WriteHeader(tt.status)
+					w.Write([]byte(tt.body))
+				}))
+				defer server.Close()
+
+				_, err := newTestProvider(server.Client(), server.URL).Fetch(context.Background(), s81)
+
+				var retryable *RetryableError
+				if errors.As(err, &retryable) != tt.wantRetryable {
+					t.Fatalf("Fetch() error = %v, want retryable %v", err, tt.wantRetryable)
+				}
+				if tt.wantRetryable && retryable.RetryAfter != tt.wantRetryAfter {
+					t.Errorf("RetryAfter = %s, want %s", retryable.RetryAfter, tt.wantRetryAfter)
+				}
+
+				var rejected *RejectedPayloadError
+				if errors.As(err, &rejected) != tt.wantRejected {
+					t.Fatalf("Fetch() error = %v, want rejected %v", err, tt.wantRejected)
+				}
+				if tt.wantRejected && string(rejected.Body) != tt.body {
+					t.Errorf("rejected body = %q, want %q", rejected.Body, tt.body)
+				}
+			})
+		}
+	}
+}
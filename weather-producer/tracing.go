@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+
+	"github.com/michael-hauser/s81/telemetry"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the fetches and publishes. It delegates to the provider installed by telemetry.Setup
+var tracer = otel.Tracer(serviceName)
+
+// startPublishSpan starts a producer span for a message and injects its trace context into the message headers
+func startPublishSpan(ctx context.Context, msg *kafka.Message) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, "publish "+msg.Topic,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingKafkaMessageKey(string(msg.Key)),
+			semconv.MessagingMessageBodySize(len(msg.Value)),
+		),
+	)
+	otel.GetTextMapPropagator().Inject(ctx, telemetry.HeaderCarrier{Headers: &msg.Headers})
+	return ctx, span
+}
+
+// endSpan records err on the span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,85 @@
+package main
+
+import "time"
+
+// Condition is a provider-independent description of the sky, used by the dashboards to pick an icon
+type Condition string
+
+const (
+	ConditionClear        Condition = "clear"
+	ConditionPartlyCloudy Condition = "partly-cloudy"
+	ConditionCloudy       Condition = "cloudy"
+	ConditionShowers      Condition = "showers"
+	ConditionRain         Condition = "rain"
+	ConditionThunderstorm Condition = "thunderstorm"
+	ConditionSnow         Condition = "snow"
+	ConditionFog          Condition = "fog"
+)
+
+// Weather is the provider-independent model every provider maps its response into, before newWeatherMessage
+// trims it to the published schema.
+// Temperatures and wind speeds are in the location's units (°F and mph for imperial, °C and m/s for metric),
+// precipitation is in mm/h and probabilities are percentages.
+type Weather struct {
+	Current  CurrentWeather    `json:"current"`
+	Minutely []MinutelyWeather `json:"minutely"`
+	Hourly   []HourlyWeather   `json:"hourly"`
+	Daily    []DailyWeather    `json:"daily"`
+	Alerts   []WeatherAlert    `json:"alerts"`
+}
+
+// CurrentWeather holds the observed or nearest forecast conditions
+type CurrentWeather struct {
+	Time          time.Time `json:"time"`
+	Temperature   float64   `json:"temperature"`
+	FeelsLike     float64   `json:"feelsLike"`
+	Humidity      float64   `json:"humidity"`
+	WindSpeed     float64   `json:"windSpeed"`
+	WindDirection float64   `json:"windDirection"`
+	Condition     Condition `json:"condition"`
+	Description   string    `json:"description,omitempty"`
+	IsDay         bool      `json:"isDay"`
+}
+
+// MinutelyWeather holds the precipitation forecast for the next hour
+type MinutelyWeather struct {
+	Time          time.Time `json:"time"`
+	Precipitation float64   `json:"precipitation"`
+}
+
+// HourlyWeather holds the forecast for a single hour
+type HourlyWeather struct {
+	Time                     time.Time `json:"time"`
+	Temperature              float64   `json:"temperature"`
+	PrecipitationProbability float64   `json:"precipitationProbability"`
+	Condition                Condition `json:"condition"`
+}
+
+// DailyWeather holds the forecast for a single day
+type DailyWeather struct {
+	Date                     time.Time  `json:"date"`
+	TemperatureMax           float64    `json:"temperatureMax"`
+	TemperatureMin           float64    `json:"temperatureMin"`
+	PrecipitationProbability float64    `json:"precipitationProbability"`
+	Condition                Condition  `json:"condition"`
+	Description              string     `json:"description,omitempty"`
+	Sunrise                  *time.Time `json:"sunrise,omitempty"`
+	Sunset                   *time.Time `json:"sunset,omitempty"`
+}
+
+// WeatherAlert is a warning or advisory issued for the location, such as an NWS heat advisory.
+// Only the OpenWeather provider reports alerts.
+type WeatherAlert struct {
+	Sender      string    `json:"sender"`
+	Event       string    `json:"event"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	Description string    `json:"description"`
+	Tags        []string  `json:"tags"`
+}
+
+// Number of forecast entries kept from each provider
+const (
+	maxHourly = 48
+	maxDaily  = 8
+)
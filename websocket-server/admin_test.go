@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewAdminServer(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "")
+	if newAdminServer() != nil {
+		t.Fatal("admin server created without ADMIN_TOKEN")
+	}
+
+	t.Setenv("ADMIN_TOKEN", "admin-secret")
+	t.Setenv("ADMIN_PORT", "")
+	server := newAdminServer()
+	if server == nil || server.Addr != ":"+defaultAdminPort {
+		t.Fatalf("admin server %v, expected one on the default port", server)
+	}
+}
+
+func TestAdminLogLevel(t *testing.T) {
+	t.Setenv("ADMIN_TOKEN", "admin-secret")
+	t.Setenv("ADMIN_PORT", "")
+	handler := newAdminServer().Handler
+	defer logLevel.Set(logLevel.Level())
+
+	tests := []struct {
+		name          string
+		method        string
+		url           string
+		authorization string
+		status        int
+		level         string // Level reported in the response, if the request succeeds.
+	}{
+		{"missing token", http.MethodGet, "/admin/log-level", "", http.StatusUnauthorized, ""},
+		{"wrong token", http.MethodGet, "/admin/log-level", "Bearer wrong", http.StatusUnauthorized, ""},
+		{"invalid level", http.MethodPut, "/admin/log-level?level=LOUD", "Bearer admin-secret", http.StatusBadRequest, ""},
+		{"change level", http.MethodPut, "/admin/log-level?level=DEBUG", "Bearer admin-secret", http.StatusOK, "DEBUG"},
+		{"report level", http.MethodGet, "/admin/log-level", "Bearer admin-secret", http.StatusOK, "DEBUG"},
+		{"unsupported method", http.MethodDelete, "/admin/log-level", "Bearer admin-secret",
+			http.StatusMethodNotAllowed, ""},
+	}
+
+	logLevel.Set(slog.LevelInfo)
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.url, nil)
+		if tt.authorization != "" {
+			r.Header.Set("Authorization", tt.authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if w.Code != tt.status {
+			t.Fatalf("%s: status %d, expected %d", tt.name, w.Code, tt.status)
+		}
+		if tt.level == "" {
+			continue
+		}
+		var body map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["level"] != tt.level {
+			t.Fatalf("%s: body %q, expected level %s", tt.name, w.Body.String(), tt.level)
+		}
+	}
+}
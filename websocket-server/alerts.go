@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// Topic of the weather alert events, overridden by the WEATHER_ALERTS_TOPIC environment variable.
+// New clients get every active alert on it instead of only the latest message.
+var alertsTopic = "weather-alerts"
+
+// alertEvent holds the fields of a weather alert event needed to track which alerts are active.
+type alertEvent struct {
+	Type string    `json:"type"`
+	End  time.Time `json:"end"`
+}
+
+// activeAlert is the latest event of a weather alert that has not expired.
+type activeAlert struct {
+	msg sequencedMessage
+	end time.Time
+}
+
+// updateActiveAlerts records the latest event of an alert, keyed by the alert ID, and forgets expired alerts.
+// The caller must hold m.mu.
+func (m *ConnectionManager) updateActiveAlerts(msg sequencedMessage) {
+	var event alertEvent
+	if err := json.Unmarshal(msg.Value, &event); err != nil {
+		slog.Warn("Error parsing weather alert", "topic", msg.Topic, "offset", msg.Offset, "error", err)
+		return
+	}
+
+	now := time.Now()
+
+	if event.Type == "expired" {
+		delete(m.activeAlerts, string(msg.Key))
+	} else {
+		m.activeAlerts[string(msg.Key)] = activeAlert{msg: msg, end: event.End}
+	}
+
+	// Drop alerts that ended without an expired event, for example while the producer was down
+	for id, alert := range m.activeAlerts {
+		if alert.ended(now) {
+			delete(m.activeAlerts, id)
+		}
+	}
+}
+
+// activeAlertMessages returns the latest event of every alert still in effect, in the order they were consumed.
+// The caller must hold m.mu.
+func (m *ConnectionManager) activeAlertMessages(now time.Time) []sequencedMessage {
+	var active []sequencedMessage
+	for _, alert := range m.activeAlerts {
+		if !alert.ended(now) {
+			active = append(active, alert.msg)
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].seq < active[j].seq
+	})
+	return active
+}
+
+// ended reports whether the alert's end time has passed. Alerts without an end time stay active until expired.
+func (a activeAlert) ended(now time.Time) bool {
+	return !a.end.IsZero() && !a.end.After(now)
+}
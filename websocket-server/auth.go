@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// tokenProtocolPrefix marks a subprotocol carrying the token, for browsers that cannot set headers. It is never
+// selected, so clients using it must also offer s81.json.v1 or s81.proto.v1.
+const tokenProtocolPrefix = "s81.token."
+
+// defaultAuthLeeway is the default clock skew allowed when checking the exp and nbf claims of a token.
+const defaultAuthLeeway = 30 * time.Second
+
+// AuthConfig holds the keys that sign client tokens, which are JWTs using HMAC (HS256, HS384 or HS512).
+// Authentication is disabled when no keys are configured.
+type AuthConfig struct {
+	Keys   map[string][]byte // Secrets by key ID, matched against the kid header of a token.
+	Leeway time.Duration     // Clock skew allowed between the token issuer and the server.
+}
+
+var auth = AuthConfig{Leeway: defaultAuthLeeway}
+
+// jwtAlgorithms maps the supported JWT alg values to their hash functions.
+var jwtAlgorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// tokenClaims are the claims of a client token. Topics lists the topics the client may receive, "*" grants all.
+type tokenClaims struct {
+	Subject   string   `json:"sub"`
+	Topics    []string `json:"topics"`
+	ExpiresAt int64    `json:"exp"`
+	NotBefore int64    `json:"nbf"`
+}
+
+// loadAuthConfig reads the comma-separated AUTH_KEYS from the environment, each entry being kid:secret, and the
+// clock skew allowed for exp and nbf from AUTH_LEEWAY.
+func loadAuthConfig(c *AuthConfig) error {
+	if env := os.Getenv("AUTH_LEEWAY"); env != "" {
+		leeway, err := time.ParseDuration(env)
+		if err != nil || leeway < 0 {
+			return fmt.Errorf("AUTH_LEEWAY must be a non-negative duration, got %q", env)
+		}
+		c.Leeway = leeway
+	}
+	for _, entry := range strings.Split(os.Getenv("AUTH_KEYS"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(entry, ":")
+		if !ok || kid == "" || secret == "" {
+			return fmt.Errorf("AUTH_KEYS entries must be kid:secret, got an entry for %q", kid)
+		}
+		if c.Keys == nil {
+			c.Keys = make(map[string][]byte)
+		}
+		c.Keys[kid] = []byte(secret)
+	}
+	return nil
+}
+
+// enabled reports whether clients must present a token.
+func (c *AuthConfig) enabled() bool {
+	return len(c.Keys) > 0
+}
+
+// requestToken returns the token of an upgrade request, from the token query parameter, a bearer Authorization
+// header or a subprotocol starting with s81.token., in that order.
+func requestToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	for _, protocol := range websocket.Subprotocols(r) {
+		if token, ok := strings.CutPrefix(protocol, tokenProtocolPrefix); ok {
+			return token
+		}
+	}
+	return ""
+}
+
+// verify checks the signature, expiry and topics of a token and returns its claims. The exp and nbf claims are
+// checked with the configured leeway.
+func (c *AuthConfig) verify(token string, now time.Time) (*tokenClaims, error) {
+	if token == "" {
+		return nil, errors.New("missing token")
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+	newHash, ok := jwtAlgorithms[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %q", header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	if !c.validSignature(header.Kid, newHash, parts[0]+"."+parts[1], signature) {
+		return nil, errors.New("invalid token signature")
+	}
+
+	var claims tokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+	switch {
+	case claims.ExpiresAt == 0:
+		return nil, errors.New("token has no expiry")
+	case !now.Before(claims.expires().Add(c.Leeway)):
+		return nil, errors.New("token expired")
+	case claims.NotBefore != 0 && now.Add(c.Leeway).Before(time.Unix(claims.NotBefore, 0)):
+		return nil, errors.New("token not valid yet")
+	case len(claims.Topics) == 0:
+		return nil, errors.New("token grants no topics")
+	}
+	return &claims, nil
+}
+
+// validSignature checks the signature against the key named by kid, or every key if the token names none.
+func (c *AuthConfig) validSignature(kid string, newHash func() hash.Hash, signed string, signature []byte) bool {
+	for id, key := range c.Keys {
+		if kid != "" && id != kid {
+			continue
+		}
+		mac := hmac.New(newHash, key)
+		mac.Write([]byte(signed))
+		if hmac.Equal(mac.Sum(nil), signature) {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token.
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// expires returns the time the token expires.
+func (t *tokenClaims) expires() time.Time {
+	return time.Unix(t.ExpiresAt, 0)
+}
+
+// allowedTopics returns the set of topics the token grants, or nil if it grants every topic.
+func (t *tokenClaims) allowedTopics() map[string]struct{} {
+	allowed := make(map[string]struct{})
+	for _, topic := range t.Topics {
+		if topic == "*" {
+			return nil
+		}
+		allowed[topic] = struct{}{}
+	}
+	return allowed
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signToken creates a JWT with the given header and claims, signed with HS256 under the secret.
+func signToken(t *testing.T, header map[string]any, claims map[string]any, secret string) string {
+	t.Helper()
+	segment := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(header) + "." + segment(claims)
+
+	newHash, ok := jwtAlgorithms[header["alg"].(string)]
+	if !ok {
+		return signed + "."
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	config := AuthConfig{
+		Keys:   map[string][]byte{"current": []byte("secret-1"), "previous": []byte("secret-2")},
+		Leeway: 30 * time.Second,
+	}
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{"sub": "dashboard", "topics": []string{"weather-data"}, "exp": now.Unix() + 3600}
+		for k, v := range changes {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+	hs256 := map[string]any{"alg": "HS256", "kid": "current"}
+
+	tests := []struct {
+		name  string
+		token string
+		err   string // Empty if the token is valid.
+	}{
+		{"valid", signToken(t, hs256, claims(nil), "secret-1"), ""},
+		{"HS384", signToken(t, map[string]any{"alg": "HS384", "kid": "current"}, claims(nil), "secret-1"), ""},
+		{"HS512", signToken(t, map[string]any{"alg": "HS512", "kid": "current"}, claims(nil), "secret-1"), ""},
+		{"missing", "", "missing token"},
+		{"malformed", "abc.def", "malformed token"},
+		{"malformed header", "!!!." + strings.SplitN(signToken(t, hs256, claims(nil), "secret-1"), ".", 2)[1],
+			"malformed token header"},
+		{"alg none", signToken(t, map[string]any{"alg": "none", "kid": "current"}, claims(nil), ""),
+			`unsupported algorithm "none"`},
+		{"alg not allowed", signToken(t, map[string]any{"alg": "RS256", "kid": "current"}, claims(nil), "secret-1"),
+			`unsupported algorithm "RS256"`},
+		{"wrong secret", signToken(t, hs256, claims(nil), "other"), "invalid token signature"},
+		{"kid selects the key", signToken(t, map[string]any{"alg": "HS256", "kid": "previous"}, claims(nil), "secret-2"),
+			""},
+		{"kid of another key", signToken(t, map[string]any{"alg": "HS256", "kid": "previous"}, claims(nil), "secret-1"),
+			"invalid token signature"},
+		{"unknown kid", signToken(t, map[string]any{"alg": "HS256", "kid": "retired"}, claims(nil), "secret-1"),
+			"invalid token signature"},
+		{"no kid tries every key", signToken(t, map[string]any{"alg": "HS256"}, claims(nil), "secret-2"), ""},
+		{"tampered claims", func() string {
+			parts := strings.Split(signToken(t, hs256, claims(nil), "secret-1"), ".")
+			forged := strings.Split(signToken(t, hs256, claims(map[string]any{"topics": []string{"*"}}), "x"), ".")
+			return parts[0] + "." + forged[1] + "." + parts[2]
+		}(), "invalid token signature"},
+		{"no expiry", signToken(t, hs256, claims(map[string]any{"exp": nil}), "secret-1"), "token has no expiry"},
+		{"expired", signToken(t, hs256, claims(map[string]any{"exp": now.Unix() - 31}), "secret-1"), "token expired"},
+		{"expired within leeway", signToken(t, hs256, claims(map[string]any{"exp": now.Unix() - 29}), "secret-1"), ""},
+		{"not valid yet", signToken(t, hs256, claims(map[string]any{"nbf": now.Unix() + 31}), "secret-1"),
+			"token not valid yet"},
+		{"not valid yet within leeway", signToken(t, hs256, claims(map[string]any{"nbf": now.Unix() + 29}), "secret-1"),
+			""},
+		{"no topics", signToken(t, hs256, claims(map[string]any{"topics": []string{}}), "secret-1"),
+			"token grants no topics"},
+		{"missing topics", signToken(t, hs256, claims(map[string]any{"topics": nil}), "secret-1"),
+			"token grants no topics"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := config.verify(tt.token, now)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("expected a valid token, got %v", err)
+			case tt.err != "" && err == nil:
+				t.Fatalf("expected error %q, got a valid token", tt.err)
+			case tt.err != "" && !strings.HasPrefix(err.Error(), tt.err):
+				t.Fatalf("expected error %q, got %q", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestAllowedTopics(t *testing.T) {
+	tests := []struct {
+		name     string
+		topics   []string
+		expected map[string]struct{} // nil means every topic.
+	}{
+		{"listed topics", []string{"weather-data", "arrivals-s81"},
+			map[string]struct{}{"weather-data": {}, "arrivals-s81": {}}},
+		{"wildcard grants every topic", []string{"weather-data", "*"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed := (&tokenClaims{Topics: tt.topics}).allowedTopics()
+			if (allowed == nil) != (tt.expected == nil) || len(allowed) != len(tt.expected) {
+				t.Fatalf("allowed topics %v, expected %v", allowed, tt.expected)
+			}
+			for topic := range tt.expected {
+				if _, ok := allowed[topic]; !ok {
+					t.Fatalf("allowed topics %v, expected %v", allowed, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		header   http.Header
+		expected string
+	}{
+		{"query parameter", "/ws?token=abc", nil, "abc"},
+		{"bearer header", "/ws", http.Header{"Authorization": {"Bearer abc"}}, "abc"},
+		{"subprotocol", "/ws", http.Header{"Sec-Websocket-Protocol": {"s81.json.v1, s81.token.abc"}}, "abc"},
+		{"query parameter first", "/ws?token=abc", http.Header{"Authorization": {"Bearer def"}}, "abc"},
+		{"none", "/ws", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, tt.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+			if got := requestToken(r); got != tt.expected {
+				t.Fatalf("token %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadAuthConfig(t *testing.T) {
+	t.Setenv("AUTH_KEYS", "current:secret-1, previous:secret-2")
+	t.Setenv("AUTH_LEEWAY", "1m")
+	config := AuthConfig{Leeway: defaultAuthLeeway}
+	if err := loadAuthConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Keys) != 2 || string(config.Keys["previous"]) != "secret-2" || config.Leeway != time.Minute {
+		t.Fatalf("unexpected configuration %+v", config)
+	}
+
+	t.Setenv("AUTH_LEEWAY", "-1s")
+	if err := loadAuthConfig(&AuthConfig{}); err == nil {
+		t.Fatal("expected an error for a negative leeway")
+	}
+	t.Setenv("AUTH_LEEWAY", "")
+	t.Setenv("AUTH_KEYS", "current")
+	if err := loadAuthConfig(&AuthConfig{}); err == nil {
+		t.Fatal("expected an error for an entry without a secret")
+	}
+}
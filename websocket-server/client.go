@@ -0,0 +1,417 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// Client operations accepted over the WebSocket.
+const (
+	opSubscribe   = "subscribe"
+	opUnsubscribe = "unsubscribe"
+	opSnapshot    = "snapshot" // Resend the latest message of the topics, used to recover from a missed delta.
+)
+
+// ClientFrame represents a control message sent by a client over WebSocket.
+type ClientFrame struct {
+	Op     string   `json:"op"`
+	Topics []string `json:"topics"`
+}
+
+// QueuePolicy decides what happens when a client's outbound queue is full.
+type QueuePolicy string
+
+const (
+	PolicyDropOldest QueuePolicy = "drop-oldest" // Discard the oldest queued message.
+	PolicyCoalesce   QueuePolicy = "coalesce"    // Replace queued messages for the same topic and key with the newest one.
+	PolicyDisconnect QueuePolicy = "disconnect"  // Close the connection.
+)
+
+// parseQueuePolicy converts a configuration value into a QueuePolicy.
+func parseQueuePolicy(value string) (QueuePolicy, error) {
+	switch policy := QueuePolicy(value); policy {
+	case PolicyDropOldest, PolicyCoalesce, PolicyDisconnect:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown send queue policy %q", value)
+	}
+}
+
+// outboundMessage is a frame waiting to be written to a client.
+type outboundMessage struct {
+	topic       string
+	key         string // Kafka message key, messages with different keys are never coalesced.
+	messageType int    // websocket.TextMessage or websocket.BinaryMessage, depending on the subprotocol.
+	data        []byte
+}
+
+// Client wraps a WebSocket connection, its outbound queue and the set of topics it is subscribed to.
+type Client struct {
+	id       string       // Connection ID, the conn field of every log record about the connection.
+	logger   *slog.Logger // Logger tagged with the connection ID.
+	conn     *websocket.Conn
+	wire     *countingConn // Underlying network connection, counting the bytes written.
+	compress bool          // Whether permessage-deflate was negotiated.
+	protocol string        // Negotiated subprotocol, empty for clients that did not request one.
+
+	queueMu   sync.Mutex
+	queue     []outboundMessage
+	queueSize int
+	policy    QueuePolicy
+	notify    chan struct{} // Signals the writer that the queue is non-empty.
+
+	done       chan struct{}
+	closeOnce  sync.Once
+	goingAway  chan struct{} // Closed when the server shuts down.
+	goAwayOnce sync.Once
+
+	allowed map[string]struct{} // Topics granted by the client's token, nil means every topic.
+	expires time.Time           // When the client's token expires, zero if it has none.
+
+	mu     sync.RWMutex
+	topics map[string]struct{}
+	resume map[string]resumePosition // Positions the client resumes from, used by the first subscribe to each topic.
+}
+
+// newClient creates a client that is not subscribed to any topic until it asks for some.
+func newClient(conn *websocket.Conn, wire *countingConn, compress bool, queueSize int, policy QueuePolicy) *Client {
+	if compress {
+		conn.SetCompressionLevel(compression.Level)
+	}
+	wire.startFrames()
+	id := uuid.New().String()
+	return &Client{
+		id:        id,
+		logger:    slog.With("conn", id),
+		conn:      conn,
+		wire:      wire,
+		compress:  compress,
+		protocol:  conn.Subprotocol(),
+		queueSize: queueSize,
+		policy:    policy,
+		notify:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		goingAway: make(chan struct{}),
+		topics:    make(map[string]struct{}),
+	}
+}
+
+// enqueue adds a message to the outbound queue, applying the queue policy if it is full.
+// It returns false if the client should be disconnected.
+func (c *Client) enqueue(msg outboundMessage) bool {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+
+	if len(c.queue) >= c.queueSize {
+		switch c.policy {
+		case PolicyDisconnect:
+			return false
+		case PolicyCoalesce:
+			c.queue = coalesce(c.queue, msg)
+		}
+		// Drop the oldest message if coalescing didn't free up a slot
+		if len(c.queue) >= c.queueSize {
+			c.queue = c.queue[1:]
+		}
+	}
+	c.queue = append(c.queue, msg)
+
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// coalesce removes queued messages with the same topic and key as the new message.
+func coalesce(queue []outboundMessage, newer outboundMessage) []outboundMessage {
+	kept := queue[:0]
+	for _, msg := range queue {
+		if msg.topic != newer.topic || msg.key != newer.key {
+			kept = append(kept, msg)
+		}
+	}
+	return kept
+}
+
+// drain takes every queued message.
+func (c *Client) drain() []outboundMessage {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+
+	queued := c.queue
+	c.queue = nil
+	return queued
+}
+
+// close stops the writer and closes the underlying connection. It is safe to call more than once.
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// goAway makes the writer flush the queue and close the connection with 1001 (going away). It is safe to call
+// more than once.
+func (c *Client) goAway() {
+	c.goAwayOnce.Do(func() {
+		close(c.goingAway)
+	})
+}
+
+// isGoingAway reports whether the server asked the client to go away.
+func (c *Client) isGoingAway() bool {
+	select {
+	case <-c.goingAway:
+		return true
+	default:
+		return false
+	}
+}
+
+// writeLoop is the only goroutine that writes to the connection. It sends queued messages and pings,
+// and closes the connection when the client's token expires or the server shuts down.
+func (c *Client) writeLoop() {
+	ticker := time.NewTicker(pingPeriod)
+	defer ticker.Stop()
+	reason := reasonWriteError
+	defer func() { manager.removeAndCloseConnection(c, reason) }()
+
+	var expired <-chan time.Time
+	if !c.expires.IsZero() {
+		timer := time.NewTimer(time.Until(c.expires))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.goingAway:
+			reason = reasonShutdown
+			for _, msg := range c.drain() {
+				if err := c.send(msg); err != nil {
+					return
+				}
+			}
+			if err := c.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")); err != nil {
+				return
+			}
+			// The reader removes the connection once the client acknowledges the close frame
+			select {
+			case <-c.done:
+			case <-time.After(closeGracePeriod):
+			}
+			return
+		case <-expired:
+			c.logger.Info("Closing connection, token expired")
+			reason = reasonTokenExpired
+			c.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "token expired"))
+			return
+		case <-c.notify:
+			for _, msg := range c.drain() {
+				if err := c.send(msg); err != nil {
+					c.logger.Warn("Error writing message to WebSocket", "topic", msg.topic, "error", err)
+					return
+				}
+			}
+		case <-ticker.C:
+			if err := c.write(websocket.PingMessage, nil); err != nil {
+				writeErrors.Inc()
+				c.logger.Warn("Error writing ping message", "error", err)
+				return
+			}
+		}
+	}
+}
+
+// send writes a queued message, counting the bytes sent for its topic or the failed write.
+func (c *Client) send(msg outboundMessage) error {
+	if err := c.write(msg.messageType, msg.data); err != nil {
+		writeErrors.Inc()
+		return err
+	}
+	bytesSent.WithLabelValues(msg.topic).Add(float64(len(msg.data)))
+	return nil
+}
+
+// write sends a single frame to the peer. Data messages are compressed if compression was negotiated and they
+// reach the size threshold.
+func (c *Client) write(messageType int, data []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+		return c.conn.WriteMessage(messageType, data)
+	}
+
+	compressed := c.compress && len(data) >= compression.Threshold
+	c.conn.EnableWriteCompression(compressed)
+	before := c.wire.written.Load()
+	if err := c.conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	recordWrite(compressed, len(data), c.wire.written.Load()-before)
+	return nil
+}
+
+// isSubscribed reports whether the client wants messages for the topic and its token grants it.
+func (c *Client) isSubscribed(topic string) bool {
+	if !c.isAllowed(topic) {
+		return false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, ok := c.topics[topic]
+	return ok
+}
+
+// isAllowed reports whether the client's token grants the topic.
+func (c *Client) isAllowed(topic string) bool {
+	if c.allowed == nil {
+		return true
+	}
+	_, ok := c.allowed[topic]
+	return ok
+}
+
+// allowedTopics returns the requested topics the client's token grants.
+func (c *Client) allowedTopics(requested []string) []string {
+	var allowed []string
+	for _, topic := range requested {
+		if c.isAllowed(topic) {
+			allowed = append(allowed, topic)
+		}
+	}
+	return allowed
+}
+
+// subscribe adds topics to the client's subscriptions and returns the ones that were newly added.
+func (c *Client) subscribe(requested []string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var added []string
+	for _, topic := range requested {
+		if _, ok := c.topics[topic]; !ok {
+			c.topics[topic] = struct{}{}
+			added = append(added, topic)
+		}
+	}
+	return added
+}
+
+// unsubscribe removes topics from the client's subscriptions.
+func (c *Client) unsubscribe(requested []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, topic := range requested {
+		delete(c.topics, topic)
+	}
+}
+
+// takeResume returns the resume positions of the given topics and forgets them, since the messages replayed from
+// them make the positions stale.
+func (c *Client) takeResume(requested []string) map[string]resumePosition {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	positions := make(map[string]resumePosition)
+	for _, topic := range requested {
+		if position, ok := c.resume[topic]; ok {
+			positions[topic] = position
+			delete(c.resume, topic)
+		}
+	}
+	return positions
+}
+
+// readLoop reads control frames from the client until the connection fails.
+func readLoop(client *Client) {
+	reason := reasonReadError
+	defer func() { manager.removeAndCloseConnection(client, reason) }()
+
+	client.conn.SetReadLimit(maxMessageSize)
+	client.conn.SetReadDeadline(time.Now().Add(pongWait))
+	client.conn.SetPongHandler(func(string) error {
+		client.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		_, data, err := client.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				client.logger.Warn("Error reading from WebSocket", "error", err)
+			}
+			switch {
+			case client.isGoingAway():
+				reason = reasonShutdown
+			case websocket.IsCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived):
+				reason = reasonClientClosed
+			}
+			return
+		}
+
+		var frame ClientFrame
+		if err := json.Unmarshal(data, &frame); err != nil {
+			client.logger.Warn("Error unmarshaling client frame", "error", err)
+			continue
+		}
+		handleFrame(client, frame)
+	}
+}
+
+// handleFrame applies a control frame sent by the client.
+func handleFrame(client *Client, frame ClientFrame) {
+	requested := knownTopics(client, frame.Topics)
+	if allowed := client.allowedTopics(requested); len(allowed) < len(requested) {
+		client.logger.Warn("Token grants only some of the requested topics", "allowed", allowed, "requested", requested)
+		requested = allowed
+	}
+
+	client.logger.Debug("Received client frame", "op", frame.Op, "topics", requested)
+	switch frame.Op {
+	case opSubscribe:
+		added := client.subscribe(requested)
+		manager.sendLatestMessages(client, added)
+	case opUnsubscribe:
+		client.unsubscribe(requested)
+	case opSnapshot:
+		manager.sendSnapshot(client, requested)
+	default:
+		client.logger.Warn("Unknown client op", "op", frame.Op)
+	}
+}
+
+// knownTopics returns the requested topics that the server consumes, logging any it does not.
+func knownTopics(client *Client, requested []string) []string {
+	var known []string
+	for _, topic := range requested {
+		if !isKnownTopic(topic) {
+			client.logger.Warn("Ignoring unknown topic", "topic", topic)
+			continue
+		}
+		known = append(known, topic)
+	}
+	return known
+}
+
+// isKnownTopic checks if the server consumes the given topic.
+func isKnownTopic(topic string) bool {
+	for _, t := range topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
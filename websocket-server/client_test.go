@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestSubscribe(t *testing.T) {
+	client := newTestClient(8, PolicyDisconnect)
+	if client.isSubscribed("weather-data") {
+		t.Fatal("a new client is subscribed before asking for any topic")
+	}
+
+	added := client.subscribe([]string{"weather-data", "arrivals-s81"})
+	if len(added) != 2 || added[0] != "weather-data" || added[1] != "arrivals-s81" {
+		t.Fatalf("first subscribe added %v, expected the requested topics", added)
+	}
+	if added := client.subscribe([]string{"weather-data", "weather-alerts"}); len(added) != 1 || added[0] != "weather-alerts" {
+		t.Fatalf("second subscribe added %v, expected only the new topic", added)
+	}
+
+	client.unsubscribe([]string{"weather-data"})
+	if client.isSubscribed("weather-data") || !client.isSubscribed("arrivals-s81") {
+		t.Fatal("unsubscribe removed the wrong topics")
+	}
+
+	client.allowed = map[string]struct{}{"weather-alerts": {}}
+	if client.isSubscribed("arrivals-s81") || !client.isSubscribed("weather-alerts") {
+		t.Fatal("subscriptions are not limited to the topics the token grants")
+	}
+}
+
+func TestSubscribeReplaysFromResumePosition(t *testing.T) {
+	m := newTestManager("subway-arrivals", defaultHistorySize, 8)
+	m.record(kafka.Message{Topic: "weather-data", Offset: 3, Value: []byte(`{}`)})
+	client := newTestClient(16, PolicyDisconnect)
+	client.resume = map[string]resumePosition{"subway-arrivals": {partition: 0, offset: 5}}
+	m.connections[client] = struct{}{}
+
+	// Nothing is replayed until the client subscribes, and only for the topics it subscribes to
+	if got := queuedOffsets(t, client); len(got) != 0 {
+		t.Fatalf("replayed offsets %v before subscribing", got)
+	}
+	m.sendLatestMessages(client, client.subscribe([]string{"subway-arrivals"}))
+	if got := queuedOffsets(t, client); len(got) != 3 || got[0] != 6 || got[2] != 8 {
+		t.Fatalf("replayed offsets %v, expected the missed messages [6 7 8]", got)
+	}
+
+	// The position is used once, a later subscribe to the topic gets the latest message
+	client.unsubscribe([]string{"subway-arrivals"})
+	m.sendLatestMessages(client, client.subscribe([]string{"subway-arrivals", "weather-data"}))
+	if got := queuedOffsets(t, client); len(got) != 2 || got[0] != 8 || got[1] != 3 {
+		t.Fatalf("replayed offsets %v, expected the latest messages [8 3]", got)
+	}
+}
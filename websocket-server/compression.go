@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CompressionConfig controls permessage-deflate compression of outgoing messages.
+type CompressionConfig struct {
+	Enabled   bool
+	Level     int // flate level, from -2 (Huffman only) to 9 (best compression).
+	Threshold int // Messages smaller than this many bytes are sent uncompressed.
+}
+
+var compression = CompressionConfig{
+	Enabled:   true,
+	Level:     flate.BestSpeed,
+	Threshold: 1024,
+}
+
+// Compression metrics served on /metrics, by whether the message was compressed. The compression ratio is
+// websocket_compression_wire_bytes_total{compressed="true"} / websocket_compression_payload_bytes_total{compressed="true"}.
+var (
+	compressionMessages = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_compression_messages_total",
+		Help: "Data messages written to clients, by whether they were compressed.",
+	}, []string{"compressed"})
+	compressionPayloadBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_compression_payload_bytes_total",
+		Help: "Payload bytes of the data messages written to clients before compression, by whether they were compressed.",
+	}, []string{"compressed"})
+	compressionWireBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_compression_wire_bytes_total",
+		Help: "Bytes of the data frames written to the network, headers included, by whether they were compressed.",
+	}, []string{"compressed"})
+)
+
+func init() {
+	prometheus.MustRegister(compressionMessages, compressionPayloadBytes, compressionWireBytes)
+}
+
+// loadCompressionConfig reads the compression settings from the environment.
+func loadCompressionConfig(c *CompressionConfig) error {
+	if enabled := os.Getenv("COMPRESSION_ENABLED"); enabled != "" {
+		b, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return fmt.Errorf("COMPRESSION_ENABLED must be a boolean, got %q", enabled)
+		}
+		c.Enabled = b
+	}
+	if level := os.Getenv("COMPRESSION_LEVEL"); level != "" {
+		n, err := strconv.Atoi(level)
+		if err != nil || n < flate.HuffmanOnly || n > flate.BestCompression {
+			return fmt.Errorf("COMPRESSION_LEVEL must be between %d and %d, got %q", flate.HuffmanOnly, flate.BestCompression, level)
+		}
+		c.Level = n
+	}
+	if threshold := os.Getenv("COMPRESSION_THRESHOLD"); threshold != "" {
+		n, err := strconv.Atoi(threshold)
+		if err != nil || n < 0 {
+			return fmt.Errorf("COMPRESSION_THRESHOLD must be a non-negative integer, got %q", threshold)
+		}
+		c.Threshold = n
+	}
+	return nil
+}
+
+// offersDeflate reports whether the client offered the permessage-deflate extension, which the upgrader accepts
+// whenever compression is enabled.
+func offersDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-Websocket-Extensions") {
+		for _, extension := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(extension, ";")
+			if strings.TrimSpace(name) == "permessage-deflate" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recordWrite updates the compression metrics for a data message written to a client.
+func recordWrite(compressed bool, payloadBytes int, wireBytes int64) {
+	label := strconv.FormatBool(compressed)
+	compressionMessages.WithLabelValues(label).Inc()
+	compressionPayloadBytes.WithLabelValues(label).Add(float64(payloadBytes))
+	compressionWireBytes.WithLabelValues(label).Add(float64(wireBytes))
+}
+
+// countingConn counts the bytes of the data frames written to a connection, which for a WebSocket are the frames
+// after compression. Control frames, such as the pongs and close frames the reader writes concurrently, are not
+// counted. The connection writes one frame at a time, each frame starting with its header at the start of a Write.
+type countingConn struct {
+	net.Conn
+	written atomic.Int64 // Bytes of data frames written.
+
+	mu        sync.Mutex
+	framing   bool  // Set once the handshake response was written, the bytes after it are frames.
+	remaining int64 // Bytes left of the frame being written.
+	data      bool  // Whether the frame being written is a data frame.
+}
+
+// startFrames marks the end of the handshake, the bytes written after it are counted.
+func (c *countingConn) startFrames() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.framing = true
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.count(p[:n])
+	return n, err
+}
+
+// count attributes written bytes to the frames they belong to.
+func (c *countingConn) count(p []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.framing {
+		return
+	}
+
+	var data int64
+	for len(p) > 0 {
+		if c.remaining == 0 {
+			length, ok := frameLength(p)
+			if !ok {
+				// Not the start of a frame, which the connection never writes, so leave the bytes uncounted
+				return
+			}
+			c.remaining = length
+			// Opcodes 0 to 2 are continuation, text and binary frames, the others are control frames
+			c.data = p[0]&0x0f <= 2
+		}
+		n := min(int64(len(p)), c.remaining)
+		if c.data {
+			data += n
+		}
+		c.remaining -= n
+		p = p[n:]
+	}
+	c.written.Add(data)
+}
+
+// frameLength returns the length of the WebSocket frame starting at p, header included, or false if p does not
+// hold a complete frame header.
+func frameLength(p []byte) (int64, bool) {
+	if len(p) < 2 {
+		return 0, false
+	}
+	header := int64(2)
+	length := int64(p[1] & 0x7f)
+	switch length {
+	case 126:
+		if len(p) < 4 {
+			return 0, false
+		}
+		header, length = 4, int64(binary.BigEndian.Uint16(p[2:4]))
+	case 127:
+		if len(p) < 10 {
+			return 0, false
+		}
+		header, length = 10, int64(binary.BigEndian.Uint64(p[2:10]))
+	}
+	if p[1]&0x80 != 0 {
+		header += 4 // Masking key, only sent by clients.
+	}
+	return header + length, true
+}
+
+// countingResponseWriter hands the upgrader a countingConn when it hijacks the connection.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	conn *countingConn
+}
+
+func (w *countingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.conn = &countingConn{Conn: conn}
+	return w.conn, rw, nil
+}
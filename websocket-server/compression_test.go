@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// discardConn is a connection that accepts every write.
+type discardConn struct {
+	net.Conn
+}
+
+func (discardConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// frame builds an unmasked WebSocket frame with the given opcode, written as one Write or split in two.
+func frame(opcode byte, payload []byte) []byte {
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) < 1<<16:
+		header = append(header, 126, byte(len(payload)>>8), byte(len(payload)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, byte(len(payload)>>24), byte(len(payload)>>16), byte(len(payload)>>8),
+			byte(len(payload)))
+	}
+	return append(header, payload...)
+}
+
+func TestCountingConnCountsDataFramesOnly(t *testing.T) {
+	conn := &countingConn{Conn: discardConn{}}
+	conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\n\r\n"))
+	conn.startFrames()
+	text := frame(websocket.TextMessage, bytes.Repeat([]byte("a"), 300))
+	binary := frame(websocket.BinaryMessage, bytes.Repeat([]byte("b"), 70000))
+
+	conn.Write(text)
+	conn.Write(frame(websocket.PongMessage, []byte("pong")))
+	// A large frame is written as its header and payload in separate writes
+	conn.Write(binary[:10])
+	conn.Write(binary[10:5000])
+	conn.Write(binary[5000:])
+	conn.Write(frame(websocket.CloseMessage, []byte{0x03, 0xe8}))
+	conn.Write(frame(websocket.PingMessage, nil))
+
+	if got, expected := conn.written.Load(), int64(len(text)+len(binary)); got != expected {
+		t.Fatalf("counted %d bytes, expected the %d bytes of the data frames", got, expected)
+	}
+}
+
+func TestCompressionMetrics(t *testing.T) {
+	payload := []byte(strings.Repeat(`{"line":"C","direction":"N","arrivalTime":1726574400},`, 100))
+	written := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter := &countingResponseWriter{ResponseWriter: w}
+		upgrader := websocket.Upgrader{EnableCompression: true}
+		conn, err := upgrader.Upgrade(counter, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		client := newClient(conn, counter.conn, offersDeflate(r), 8, PolicyDisconnect)
+		if err := client.write(websocket.TextMessage, payload); err != nil {
+			t.Error(err)
+		}
+		written <- struct{}{}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		deflate  bool
+		label    string
+		maxRatio float64
+	}{
+		{"deflate client", true, "true", 0.2},
+		{"client without deflate", false, "false", 1.01},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages := testutil.ToFloat64(compressionMessages.WithLabelValues(tt.label))
+			payloadBytes := testutil.ToFloat64(compressionPayloadBytes.WithLabelValues(tt.label))
+			wireBytes := testutil.ToFloat64(compressionWireBytes.WithLabelValues(tt.label))
+
+			dialer := websocket.Dialer{EnableCompression: tt.deflate}
+			conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			_, received, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			<-written
+			if !bytes.Equal(received, payload) {
+				t.Fatal("received message differs from the one written")
+			}
+
+			if got := testutil.ToFloat64(compressionMessages.WithLabelValues(tt.label)) - messages; got != 1 {
+				t.Fatalf("counted %v messages, expected 1", got)
+			}
+			payloadBytes = testutil.ToFloat64(compressionPayloadBytes.WithLabelValues(tt.label)) - payloadBytes
+			wireBytes = testutil.ToFloat64(compressionWireBytes.WithLabelValues(tt.label)) - wireBytes
+			if payloadBytes != float64(len(payload)) {
+				t.Fatalf("counted %v payload bytes, expected %d", payloadBytes, len(payload))
+			}
+			if ratio := wireBytes / payloadBytes; ratio <= 0 || ratio > tt.maxRatio {
+				t.Fatalf("compression ratio %v, expected at most %v", ratio, tt.maxRatio)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+
+	envelopepb "websocket-server/proto"
+)
+
+// WebSocket subprotocols a client can negotiate with Sec-WebSocket-Protocol. Clients that do not request one get JSON.
+const (
+	protocolProto = "s81.proto.v1" // Binary frames holding an Envelope from proto/envelope.proto.
+	protocolJSON  = "s81.json.v1"  // Text frames holding a JSON WebSocketValue.
+)
+
+// protocolHeader selects the first supported subprotocol the client offered, in the client's order of preference,
+// and returns the response header announcing it. It returns nil if the client offered none.
+func protocolHeader(r *http.Request) http.Header {
+	for _, protocol := range websocket.Subprotocols(r) {
+		if protocol == protocolProto || protocol == protocolJSON {
+			return http.Header{"Sec-Websocket-Protocol": []string{protocol}}
+		}
+	}
+	return nil
+}
+
+// encodedMessage is a Kafka message encoded once for each subprotocol, so a broadcast encodes it only twice.
+type encodedMessage struct {
+	topic string
+	key   string
+	json  []byte
+	proto []byte
+}
+
+// encodeMessage encodes a consumed message as a JSON WebSocketValue and as a protobuf Envelope, generated from
+// proto/envelope.proto by protoc-gen-go.
+func encodeMessage(msg sequencedMessage) (encodedMessage, error) {
+	jsonValue, err := json.Marshal(WebSocketValue{
+		Key:        msg.Topic,
+		MessageKey: string(msg.Key),
+		Value:      string(msg.Value),
+		Partition:  msg.Partition,
+		Offset:     msg.Offset,
+		Seq:        msg.seq,
+	})
+	if err != nil {
+		return encodedMessage{}, err
+	}
+	protoValue, err := proto.Marshal(&envelopepb.Envelope{
+		Key:        msg.Topic,
+		MessageKey: string(msg.Key),
+		Value:      msg.Value,
+		Partition:  int32(msg.Partition),
+		Offset:     msg.Offset,
+		Seq:        msg.seq,
+	})
+	if err != nil {
+		return encodedMessage{}, err
+	}
+
+	return encodedMessage{
+		topic: msg.Topic,
+		key:   string(msg.Key),
+		json:  jsonValue,
+		proto: protoValue,
+	}, nil
+}
+
+// outbound returns the frame to queue for a client that negotiated the given subprotocol.
+func (m encodedMessage) outbound(protocol string) outboundMessage {
+	if protocol == protocolProto {
+		return outboundMessage{topic: m.topic, key: m.key, messageType: websocket.BinaryMessage, data: m.proto}
+	}
+	return outboundMessage{topic: m.topic, key: m.key, messageType: websocket.TextMessage, data: m.json}
+}
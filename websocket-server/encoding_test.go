@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/segmentio/kafka-go"
+	"google.golang.org/protobuf/proto"
+
+	envelopepb "websocket-server/proto"
+)
+
+func TestEncodeMessageRoundTrip(t *testing.T) {
+	msg := sequencedMessage{
+		Message: kafka.Message{
+			Topic:     "arrivals-s81",
+			Key:       []byte("s81"),
+			Value:     []byte(`{"arrivals":[{"line":"C","arrivalTime":1726574400}]}`),
+			Partition: 2,
+			Offset:    1 << 40,
+		},
+		seq: 1<<63 + 7,
+	}
+	encoded, err := encodeMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var envelope envelopepb.Envelope
+	if err := proto.Unmarshal(encoded.proto, &envelope); err != nil {
+		t.Fatalf("protobuf frame does not decode as an Envelope: %v", err)
+	}
+	if envelope.Key != msg.Topic || !bytes.Equal(envelope.Value, msg.Value) || envelope.Partition != 2 ||
+		envelope.Offset != msg.Offset || envelope.Seq != msg.seq || envelope.MessageKey != "s81" {
+		t.Fatalf("decoded envelope %v does not match the message", &envelope)
+	}
+
+	var value WebSocketValue
+	if err := json.Unmarshal(encoded.json, &value); err != nil {
+		t.Fatalf("JSON frame does not decode as a WebSocketValue: %v", err)
+	}
+	expected := WebSocketValue{Key: msg.Topic, MessageKey: "s81", Value: string(msg.Value), Partition: 2,
+		Offset: msg.Offset, Seq: msg.seq}
+	if value != expected {
+		t.Fatalf("decoded value %+v, expected %+v", value, expected)
+	}
+}
+
+func TestOutbound(t *testing.T) {
+	encoded := encodedMessage{topic: "weather-data", key: "s81", json: []byte(`{}`), proto: []byte{0x0a}}
+	tests := []struct {
+		protocol    string
+		messageType int
+		data        []byte
+	}{
+		{protocolProto, websocket.BinaryMessage, encoded.proto},
+		{protocolJSON, websocket.TextMessage, encoded.json},
+		{"", websocket.TextMessage, encoded.json},
+	}
+
+	for _, tt := range tests {
+		out := encoded.outbound(tt.protocol)
+		if out.messageType != tt.messageType || !bytes.Equal(out.data, tt.data) || out.topic != "weather-data" ||
+			out.key != "s81" {
+			t.Fatalf("protocol %q: unexpected frame %+v", tt.protocol, out)
+		}
+	}
+}
+
+func TestProtocolHeader(t *testing.T) {
+	tests := []struct {
+		offered  string
+		expected string // Empty if no subprotocol is selected.
+	}{
+		{"s81.proto.v1", protocolProto},
+		{"s81.json.v1, s81.proto.v1", protocolJSON},
+		{"s81.token.abc, s81.proto.v1", protocolProto},
+		{"graphql-ws", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		r, err := http.NewRequest(http.MethodGet, "/ws", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.offered != "" {
+			r.Header.Set("Sec-Websocket-Protocol", tt.offered)
+		}
+		if got := protocolHeader(r).Get("Sec-Websocket-Protocol"); got != tt.expected {
+			t.Fatalf("offered %q: selected %q, expected %q", tt.offered, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const kafkaCheckTimeout = 2 * time.Second // Time allowed for the Kafka check of /readyz.
+
+// ReadinessConfig holds the thresholds /readyz checks the consumers against.
+type ReadinessConfig struct {
+	MaxLag      int64         // A topic whose consumer lags by more messages is not ready.
+	ErrorWindow time.Duration // A topic whose consumer failed to read this recently is not ready.
+}
+
+var readiness = ReadinessConfig{
+	MaxLag:      1000,
+	ErrorWindow: time.Minute,
+}
+
+// loadReadinessConfig reads the readiness thresholds from READY_MAX_LAG and READY_ERROR_WINDOW.
+func loadReadinessConfig(c *ReadinessConfig) error {
+	if maxLag := os.Getenv("READY_MAX_LAG"); maxLag != "" {
+		n, err := strconv.ParseInt(maxLag, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("READY_MAX_LAG must be a non-negative integer, got %q", maxLag)
+		}
+		c.MaxLag = n
+	}
+	if window := os.Getenv("READY_ERROR_WINDOW"); window != "" {
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("READY_ERROR_WINDOW must be a positive duration, got %q", window)
+		}
+		c.ErrorWindow = d
+	}
+	return nil
+}
+
+// consumerState is the Kafka reader of a topic and the last error reading from it.
+type consumerState struct {
+	reader    *kafka.Reader
+	err       error
+	lastError time.Time
+}
+
+// consumerRegistry tracks the running consumers for readiness and metrics.
+type consumerRegistry struct {
+	mu     sync.Mutex
+	topics map[string]*consumerState
+}
+
+var consumerStates = &consumerRegistry{topics: make(map[string]*consumerState)}
+
+// add registers the reader of a topic when its consumer starts.
+func (r *consumerRegistry) add(topic string, reader *kafka.Reader) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.topics[topic] = &consumerState{reader: reader}
+}
+
+// remove unregisters the reader of a topic when its consumer stops.
+func (r *consumerRegistry) remove(topic string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.topics, topic)
+}
+
+// recordError records a failed read of a topic.
+func (r *consumerRegistry) recordError(topic string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if state, ok := r.topics[topic]; ok {
+		state.err, state.lastError = err, time.Now()
+	}
+}
+
+// readers returns the registered readers by topic.
+func (r *consumerRegistry) readers() map[string]*kafka.Reader {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	readers := make(map[string]*kafka.Reader, len(r.topics))
+	for topic, state := range r.topics {
+		readers[topic] = state.reader
+	}
+	return readers
+}
+
+// check returns why the consumer of a topic is not ready, or nil if it is.
+func (r *consumerRegistry) check(topic string, config ReadinessConfig, now time.Time) error {
+	r.mu.Lock()
+	state, ok := r.topics[topic]
+	var current consumerState
+	if ok {
+		current = *state
+	}
+	r.mu.Unlock()
+
+	if !ok {
+		return errors.New("consumer is not running")
+	}
+	return checkConsumer(current, current.reader.Stats().Lag, config, now)
+}
+
+// checkConsumer returns an error if a consumer failed to read within the error window or lags by more than the
+// maximum lag.
+func checkConsumer(state consumerState, lag int64, config ReadinessConfig, now time.Time) error {
+	if !state.lastError.IsZero() && now.Sub(state.lastError) < config.ErrorWindow {
+		return fmt.Errorf("read failed %s ago: %v", now.Sub(state.lastError).Round(time.Second), state.err)
+	}
+	if lag > config.MaxLag {
+		return fmt.Errorf("lagging by %d messages", lag)
+	}
+	return nil
+}
+
+// checkKafka connects to the broker and reads the partitions of the consumed topics.
+func checkKafka(ctx context.Context, checkTopics []string) error {
+	ctx, cancel := context.WithTimeout(ctx, kafkaCheckTimeout)
+	defer cancel()
+
+	conn, err := kafka.DialContext(ctx, "tcp", kafkaBroker())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(kafkaCheckTimeout))
+
+	partitions, err := conn.ReadPartitions(checkTopics...)
+	if err != nil {
+		return err
+	}
+	found := make(map[string]bool)
+	for _, partition := range partitions {
+		found[partition.Topic] = true
+	}
+	for _, topic := range checkTopics {
+		if !found[topic] {
+			return fmt.Errorf("topic %s does not exist", topic)
+		}
+	}
+	return nil
+}
+
+// healthResponse is the body of /healthz and /readyz, checks maps each check to "ok" or the reason it failed.
+type healthResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// handleHealthz reports that the process is alive.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// handleReadyz reports whether Kafka is reachable and every topic's consumer is running, error free and keeping up.
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	response := healthResponse{Status: "ready", Checks: make(map[string]string)}
+	check := func(name string, err error) {
+		if err != nil {
+			response.Status = "not ready"
+			response.Checks[name] = err.Error()
+			return
+		}
+		response.Checks[name] = "ok"
+	}
+
+	check("kafka", checkKafka(r.Context(), topics))
+	now := time.Now()
+	for _, topic := range topics {
+		check("consumer:"+topic, consumerStates.check(topic, readiness, now))
+	}
+
+	status := http.StatusOK
+	if response.Status != "ready" {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, response)
+}
+
+// writeHealth writes a health response as JSON.
+func writeHealth(w http.ResponseWriter, status int, response healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Error writing health response", "error", err)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestCheckConsumer(t *testing.T) {
+	now := time.Date(2024, 9, 17, 10, 0, 0, 0, time.UTC)
+	config := ReadinessConfig{MaxLag: 100, ErrorWindow: time.Minute}
+	failure := errors.New("broker not available")
+
+	tests := []struct {
+		name  string
+		state consumerState
+		lag   int64
+		want  string
+	}{
+		{"healthy", consumerState{}, 0, ""},
+		{"lag at the threshold", consumerState{}, 100, ""},
+		{"lag above the threshold", consumerState{}, 101, "lagging by 101 messages"},
+		{"recent error", consumerState{err: failure, lastError: now.Add(-10 * time.Second)}, 0,
+			"read failed 10s ago: broker not available"},
+		{"error outside the window", consumerState{err: failure, lastError: now.Add(-2 * time.Minute)}, 0, ""},
+		{"recent error and lag", consumerState{err: failure, lastError: now.Add(-time.Second)}, 500,
+			"read failed 1s ago: broker not available"},
+	}
+	for _, test := range tests {
+		err := checkConsumer(test.state, test.lag, config, now)
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestConsumerRegistryCheck(t *testing.T) {
+	registry := &consumerRegistry{topics: make(map[string]*consumerState)}
+	config := ReadinessConfig{MaxLag: 100, ErrorWindow: time.Minute}
+
+	if err := registry.check("weather-data", config, time.Now()); err == nil || err.Error() != "consumer is not running" {
+		t.Fatalf("got %v for a topic without a consumer", err)
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{Brokers: []string{"localhost:0"}, Topic: "weather-data"})
+	defer reader.Close()
+	registry.add("weather-data", reader)
+	if err := registry.check("weather-data", config, time.Now()); err != nil {
+		t.Fatalf("got %v for a running consumer", err)
+	}
+	registry.recordError("weather-data", errors.New("broker not available"))
+	if err := registry.check("weather-data", config, time.Now()); err == nil {
+		t.Fatal("a consumer that just failed to read is ready")
+	}
+	registry.remove("weather-data")
+	if err := registry.check("weather-data", config, time.Now()); err == nil {
+		t.Fatal("a removed consumer is ready")
+	}
+}
+
+func TestLoadReadinessConfig(t *testing.T) {
+	t.Setenv("READY_MAX_LAG", "50")
+	t.Setenv("READY_ERROR_WINDOW", "30s")
+	config := ReadinessConfig{MaxLag: 1000, ErrorWindow: time.Minute}
+	if err := loadReadinessConfig(&config); err != nil {
+		t.Fatal(err)
+	}
+	if config.MaxLag != 50 || config.ErrorWindow != 30*time.Second {
+		t.Fatalf("unexpected configuration %+v", config)
+	}
+
+	for _, env := range []struct{ key, value string }{
+		{"READY_MAX_LAG", "-1"}, {"READY_MAX_LAG", "many"}, {"READY_ERROR_WINDOW", "0s"},
+	} {
+		t.Run(env.key+"="+env.value, func(t *testing.T) {
+			t.Setenv(env.key, env.value)
+			if err := loadReadinessConfig(&ReadinessConfig{}); err == nil {
+				t.Fatalf("expected an error for %s=%s", env.key, env.value)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const defaultHistorySize = 64 // Default number of messages kept per topic for clients resuming after a reconnect.
+
+// sequencedMessage is a consumed Kafka message with the sequence number the server assigned to it.
+// Sequence numbers increase across all topics and restart with the server.
+type sequencedMessage struct {
+	kafka.Message
+	seq uint64
+}
+
+// ringBuffer holds the most recent messages of a topic.
+type ringBuffer struct {
+	messages []sequencedMessage
+	next     int // Index the next message is written to, the oldest message once the buffer is full.
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{messages: make([]sequencedMessage, 0, size)}
+}
+
+// add appends a message, overwriting the oldest one if the buffer is full.
+func (b *ringBuffer) add(msg sequencedMessage) {
+	if len(b.messages) < cap(b.messages) {
+		b.messages = append(b.messages, msg)
+		return
+	}
+	b.messages[b.next] = msg
+	b.next = (b.next + 1) % len(b.messages)
+}
+
+// since returns the buffered messages of a partition after the given offset, oldest first. It returns false if
+// the message following the offset is no longer buffered, in which case the client needs a snapshot instead.
+func (b *ringBuffer) since(position resumePosition) ([]sequencedMessage, bool) {
+	var missed []sequencedMessage
+	found := false
+	for i := range b.messages {
+		msg := b.messages[(b.next+i)%len(b.messages)]
+		if msg.Partition != position.partition {
+			continue
+		}
+		if !found && msg.Offset > position.offset+1 {
+			return nil, false
+		}
+		found = true
+		if msg.Offset > position.offset {
+			missed = append(missed, msg)
+		}
+	}
+	return missed, found
+}
+
+// resumePosition is the last message of a topic a reconnecting client received.
+type resumePosition struct {
+	partition int
+	offset    int64
+}
+
+// parseResume parses the resume query parameter, a comma-separated list of topic:partition:offset entries.
+func parseResume(value string) (map[string]resumePosition, error) {
+	positions := make(map[string]resumePosition)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("resume entry %q is not topic:partition:offset", entry)
+		}
+		partition, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("resume entry %q has an invalid partition", entry)
+		}
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("resume entry %q has an invalid offset", entry)
+		}
+		positions[fields[0]] = resumePosition{partition: partition, offset: offset}
+	}
+	return positions, nil
+}
+
+// loadHistoryConfig reads the number of messages kept per topic from the environment.
+func loadHistoryConfig(m *ConnectionManager) error {
+	if size := os.Getenv("HISTORY_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 {
+			return fmt.Errorf("HISTORY_SIZE must be a positive integer, got %q", size)
+		}
+		m.historySize = n
+	}
+	return nil
+}
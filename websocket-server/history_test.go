@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// newTestClient creates a client without a connection, for tests that only look at its queue.
+func newTestClient(queueSize int, policy QueuePolicy) *Client {
+	return &Client{
+		id:        "test",
+		logger:    slog.Default(),
+		queueSize: queueSize,
+		policy:    policy,
+		notify:    make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		goingAway: make(chan struct{}),
+		topics:    make(map[string]struct{}),
+	}
+}
+
+// newTestManager creates a manager that consumed count messages on the topic, at offsets 1 to count.
+func newTestManager(topic string, historySize, count int) *ConnectionManager {
+	m := &ConnectionManager{
+		connections:    make(map[*Client]struct{}),
+		latestMessages: make(map[string]map[string]sequencedMessage),
+		activeAlerts:   make(map[string]activeAlert),
+		history:        make(map[string]*ringBuffer),
+		historySize:    historySize,
+	}
+	for offset := 1; offset <= count; offset++ {
+		m.record(kafka.Message{Topic: topic, Offset: int64(offset), Value: []byte(`{}`)})
+	}
+	return m
+}
+
+// queuedOffsets returns the offsets of the messages in the client's queue.
+func queuedOffsets(t *testing.T, client *Client) []int64 {
+	t.Helper()
+	var offsets []int64
+	for _, msg := range client.drain() {
+		var value WebSocketValue
+		if err := json.Unmarshal(msg.data, &value); err != nil {
+			t.Fatalf("queued message is not a WebSocketValue: %v", err)
+		}
+		offsets = append(offsets, value.Offset)
+	}
+	return offsets
+}
+
+func TestReplay(t *testing.T) {
+	const topic = "subway-arrivals"
+	const queueSize = 8
+
+	tests := []struct {
+		name        string
+		historySize int
+		resume      int64 // Offset the client resumes from, 0 for no position.
+		policy      QueuePolicy
+		expected    []int64
+	}{
+		{"no position sends the snapshot", 64, 0, PolicyDisconnect, []int64{64}},
+		{"missed messages that fit are replayed", 64, 60, PolicyDisconnect, []int64{61, 62, 63, 64}},
+		{"missed messages filling the queue are replayed", 64, 56, PolicyDisconnect,
+			[]int64{57, 58, 59, 60, 61, 62, 63, 64}},
+		{"more missed messages than the queue holds send the snapshot", 64, 40, PolicyDisconnect, []int64{64}},
+		{"more missed messages than the queue holds with coalesce", 64, 40, PolicyCoalesce, []int64{64}},
+		{"position no longer in the history sends the snapshot", 16, 10, PolicyDisconnect, []int64{64}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestManager(topic, tt.historySize, 64)
+			client := newTestClient(queueSize, tt.policy)
+			m.connections[client] = struct{}{}
+
+			var positions map[string]resumePosition
+			if tt.resume > 0 {
+				positions = map[string]resumePosition{topic: {partition: 0, offset: tt.resume}}
+			}
+			m.replay(client, []string{topic}, positions)
+
+			if _, ok := m.connections[client]; !ok {
+				t.Fatal("client was disconnected during the replay")
+			}
+			got := queuedOffsets(t, client)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("replayed offsets %v, expected %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Fatalf("replayed offsets %v, expected %v", got, tt.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestReplayKeepsRoomForOtherSnapshots(t *testing.T) {
+	m := newTestManager("subway-arrivals", defaultHistorySize, 8)
+	m.record(kafka.Message{Topic: "weather-data", Offset: 1, Value: []byte(`{}`)})
+	client := newTestClient(8, PolicyDisconnect)
+	m.connections[client] = struct{}{}
+
+	// Eight missed arrivals and the weather snapshot don't fit in a queue of eight
+	positions := map[string]resumePosition{"subway-arrivals": {partition: 0, offset: 0}}
+	m.replay(client, []string{"subway-arrivals", "weather-data"}, positions)
+
+	got := queuedOffsets(t, client)
+	if len(got) != 2 || got[0] != 8 || got[1] != 1 {
+		t.Fatalf("replayed offsets %v, expected the latest arrival and weather messages [8 1]", got)
+	}
+}
+
+func TestSnapshotKeepsLatestMessageOfEachKey(t *testing.T) {
+	m := newTestManager("weather-data", defaultHistorySize, 0)
+	m.record(kafka.Message{Topic: "weather-data", Key: []byte("s81"), Offset: 1, Value: []byte(`{}`)})
+	m.record(kafka.Message{Topic: "weather-data", Key: []byte("zurich-hb"), Offset: 2, Value: []byte(`{}`)})
+	m.record(kafka.Message{Topic: "weather-data", Key: []byte("s81"), Offset: 3, Value: []byte(`{}`)})
+	client := newTestClient(8, PolicyDisconnect)
+	m.connections[client] = struct{}{}
+
+	m.sendSnapshot(client, []string{"weather-data"})
+
+	got := queuedOffsets(t, client)
+	if len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Fatalf("replayed offsets %v, expected the latest message of each location [2 3]", got)
+	}
+}
+
+func TestReplaySendsAlertsOfEveryStation(t *testing.T) {
+	tests := []struct {
+		name        string
+		historySize int
+		resume      map[string]resumePosition
+	}{
+		{"new client gets the snapshot", defaultHistorySize, nil},
+		{"reconnecting client gets the missed alerts", defaultHistorySize,
+			map[string]resumePosition{"subway-alerts": {partition: 0, offset: 0}}},
+		{"reconnecting client past the history gets the snapshot", 1,
+			map[string]resumePosition{"subway-alerts": {partition: 0, offset: 0}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Each station publishes its alerts to the shared topic, keyed by the station ID
+			m := newTestManager("subway-alerts", tt.historySize, 0)
+			m.record(kafka.Message{Topic: "subway-alerts", Key: []byte("s81"), Offset: 1, Value: []byte(`{}`)})
+			m.record(kafka.Message{Topic: "subway-alerts", Key: []byte("s72"), Offset: 2, Value: []byte(`{}`)})
+			client := newTestClient(8, PolicyDisconnect)
+			client.resume = tt.resume
+			m.connections[client] = struct{}{}
+
+			m.sendLatestMessages(client, []string{"subway-alerts"})
+
+			var stations []string
+			for _, msg := range client.drain() {
+				var value WebSocketValue
+				if err := json.Unmarshal(msg.data, &value); err != nil {
+					t.Fatalf("queued message is not a WebSocketValue: %v", err)
+				}
+				stations = append(stations, value.MessageKey)
+			}
+			if len(stations) != 2 || stations[0] != "s81" || stations[1] != "s72" {
+				t.Fatalf("replayed alerts of stations %v, expected [s81 s72]", stations)
+			}
+		})
+	}
+}
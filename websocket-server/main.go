@@ -2,51 +2,79 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/michael-hauser/s81/telemetry"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	writeWait        = 15 * time.Second    // Increased time allowed to write a message to the peer.
 	pongWait         = 60 * time.Second    // Time allowed to read the next pong message from the peer.
 	pingPeriod       = (pongWait * 9) / 10 // Send pings to peer with this period.
-	closeGracePeriod = 10 * time.Second    // Time to wait before force close on connection.
+	closeGracePeriod = 5 * time.Second     // Time to wait for the peer to acknowledge a close frame.
+	maxMessageSize   = 4096                // Maximum size of a frame read from the peer.
+	defaultQueueSize = 64                  // Default number of messages buffered per connection.
 )
 
-// Topics list
-var topics = []string{"subway-a", "subway-b", "subway-c", "weather-data"}
+// Topics list, overridden by the comma-separated KAFKA_TOPICS environment variable
+var topics = []string{"subway-a", "subway-b", "subway-c", "arrivals-s81", "arrivals-s81-delta", "subway-alerts", "weather-data", "weather-status", "weather-alerts"}
 
 // WebSocket upgrader for upgrading HTTP connections to WebSocket.
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins
-	},
+	CheckOrigin: checkOrigin,
 }
 
-// WebSocketValue represents the message format sent over WebSocket.
+// WebSocketValue represents the message format sent over WebSocket. The key is the Kafka topic and the message key
+// the Kafka message key, the partition and offset are the position a reconnecting client resumes from.
 type WebSocketValue struct {
-	Key   string `json:"key"`
-	Value string `json:"value"`
+	Key        string `json:"key"`
+	MessageKey string `json:"messageKey"`
+	Value      string `json:"value"`
+	Partition  int    `json:"partition"`
+	Offset     int64  `json:"offset"`
+	Seq        uint64 `json:"seq"`
 }
 
 // ConnectionManager manages active WebSocket connections and broadcasts messages.
 type ConnectionManager struct {
 	mu             sync.RWMutex
-	connections    map[*websocket.Conn]struct{}
-	latestMessages map[string]kafka.Message
+	connections    map[*Client]struct{}
+	latestMessages map[string]map[string]sequencedMessage // Latest message by topic and Kafka message key.
+	activeAlerts   map[string]activeAlert                 // Weather alerts by ID.
+	history        map[string]*ringBuffer                 // Recent messages by topic, replayed to resuming clients.
+	historySize    int
+	sequence       uint64 // Sequence number of the last consumed message.
+	queueSize      int
+	queuePolicy    QueuePolicy
+	active         sync.WaitGroup // Connections that have not been removed yet.
+	closing        bool           // Set on shutdown, new connections are asked to go away.
 }
 
 var manager = &ConnectionManager{
-	connections:    make(map[*websocket.Conn]struct{}),
-	latestMessages: make(map[string]kafka.Message),
+	connections:    make(map[*Client]struct{}),
+	latestMessages: make(map[string]map[string]sequencedMessage),
+	activeAlerts:   make(map[string]activeAlert),
+	history:        make(map[string]*ringBuffer),
+	historySize:    defaultHistorySize,
+	queueSize:      defaultQueueSize,
+	queuePolicy:    PolicyCoalesce,
 }
 
 // Main function to start the WebSocket server.
@@ -54,166 +82,426 @@ func main() {
 	// Generate a unique identifier for this instance
 	instanceID := uuid.New().String()
 
+	if err := setupLogging(); err != nil {
+		fatal("Invalid logging configuration", "error", err)
+	}
+	if err := loadQueueConfig(manager); err != nil {
+		fatal("Invalid send queue configuration", "error", err)
+	}
+	if err := loadHistoryConfig(manager); err != nil {
+		fatal("Invalid history configuration", "error", err)
+	}
+	if err := loadAuthConfig(&auth); err != nil {
+		fatal("Invalid authentication configuration", "error", err)
+	}
+	if !auth.enabled() {
+		slog.Warn("AUTH_KEYS is not set, clients can connect without a token")
+	}
+	if err := loadOriginConfig(&origins); err != nil {
+		fatal("Invalid origin configuration", "error", err)
+	}
+	if origins.Mode == OriginDev {
+		slog.Warn("Origin checks are relaxed for development, every origin may connect")
+	}
+	if err := loadCompressionConfig(&compression); err != nil {
+		fatal("Invalid compression configuration", "error", err)
+	}
+	upgrader.EnableCompression = compression.Enabled
+	if env := os.Getenv("KAFKA_TOPICS"); env != "" {
+		topics = parseTopics(env)
+	}
+	if env := os.Getenv("WEATHER_ALERTS_TOPIC"); env != "" {
+		alertsTopic = env
+	}
+
+	if err := loadReadinessConfig(&readiness); err != nil {
+		fatal("Invalid readiness configuration", "error", err)
+	}
+	shutdownTimeout, err := loadShutdownTimeout()
+	if err != nil {
+		fatal("Invalid shutdown configuration", "error", err)
+	}
+
+	// Cancel the consumers and start shutting down on SIGTERM or SIGINT
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	shutdownTracing, err := telemetry.Setup(ctx, serviceName)
+	if err != nil {
+		fatal("Invalid tracing configuration", "error", err)
+	}
+
 	// Start Kafka consumers
+	var consumers sync.WaitGroup
 	for _, topic := range topics {
-		go consumeAndSendDirectly(topic, instanceID)
+		consumers.Add(1)
+		go func(topic string) {
+			defer consumers.Done()
+			consumeAndSendDirectly(ctx, topic, instanceID)
+		}(topic)
 	}
 
 	http.HandleFunc("/ws", handleConnection)
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", handleReadyz)
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8081"
 	}
+	server := &http.Server{Addr: ":" + port}
+
+	go func() {
+		slog.Info("WebSocket server starting", "port", port, "instance", instanceID)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("Failed to start server", "error", err)
+		}
+	}()
+
+	// Serve the admin endpoints on their own internal listener, only when a token protects them
+	adminServer := newAdminServer()
+	if adminServer != nil {
+		go func() {
+			slog.Info("Admin server starting", "addr", adminServer.Addr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				fatal("Failed to start admin server", "error", err)
+			}
+		}()
+	} else {
+		slog.Info("ADMIN_TOKEN is not set, admin endpoints are disabled")
+	}
 
-	log.Printf("WebSocket server starting on port %s\n", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatalf("Failed to start server: %v\n", err)
+	<-ctx.Done()
+	slog.Info("Shutting down", "deadline", shutdownTimeout.String())
+	drainCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	shutdown(drainCtx, server, &consumers)
+	if adminServer != nil {
+		adminServer.Close()
+	}
+	if err := shutdownTracing(drainCtx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
 	}
+	slog.Info("WebSocket server stopped")
 }
 
-// handleConnection handles incoming WebSocket connections.
+// handleConnection handles incoming WebSocket connections. Clients must present a token if authentication is enabled.
+// A client can subscribe to a comma-separated list of topics with the topics query parameter, otherwise it receives
+// nothing until it sends a subscribe frame. A reconnecting client can pass the position of the last message it
+// received on each topic in the resume query parameter to get the messages it missed once it subscribes to the topic.
 func handleConnection(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	var claims *tokenClaims
+	if auth.enabled() {
+		var err error
+		if claims, err = auth.verify(requestToken(r), time.Now()); err != nil {
+			slog.Warn("Rejecting WebSocket upgrade", "remote", r.RemoteAddr, "error", err)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "invalid or missing token", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	positions, err := parseResume(r.URL.Query().Get("resume"))
 	if err != nil {
-		log.Printf("Error while connecting to WebSocket: %v\n", err)
+		slog.Warn("Ignoring resume positions", "remote", r.RemoteAddr, "error", err)
+		positions = nil
+	}
+
+	counter := &countingResponseWriter{ResponseWriter: w}
+	conn, err := upgrader.Upgrade(counter, r, protocolHeader(r))
+	if err != nil {
+		slog.Error("Error while connecting to WebSocket", "remote", r.RemoteAddr, "error", err)
 		return
 	}
 
-	manager.addConnection(conn)
-	log.Println("New WebSocket connection established")
+	client := newClient(conn, counter.conn, compression.Enabled && offersDeflate(r), manager.queueSize, manager.queuePolicy)
+	if claims != nil {
+		client.allowed, client.expires = claims.allowedTopics(), claims.expires().Add(auth.Leeway)
+	}
+	client.logger.Info("New WebSocket connection established", "remote", r.RemoteAddr, "protocol", client.protocol,
+		"compress", client.compress)
+	client.resume = positions
+	if manager.addConnection(client) {
+		if initial := parseTopics(r.URL.Query().Get("topics")); len(initial) > 0 {
+			handleFrame(client, ClientFrame{Op: opSubscribe, Topics: initial})
+		}
+	}
+	readLoop(client)
+}
+
+// parseTopics splits a comma-separated list of topics, ignoring empty entries.
+func parseTopics(value string) []string {
+	var parsed []string
+	for _, topic := range strings.Split(value, ",") {
+		if topic = strings.TrimSpace(topic); topic != "" {
+			parsed = append(parsed, topic)
+		}
+	}
+	return parsed
+}
 
-	go ping(conn)
+// loadQueueConfig reads the per-connection send queue settings from the environment.
+func loadQueueConfig(m *ConnectionManager) error {
+	if size := os.Getenv("SEND_QUEUE_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n < 1 {
+			return fmt.Errorf("SEND_QUEUE_SIZE must be a positive integer, got %q", size)
+		}
+		m.queueSize = n
+	}
+	if policy := os.Getenv("SEND_QUEUE_POLICY"); policy != "" {
+		p, err := parseQueuePolicy(policy)
+		if err != nil {
+			return err
+		}
+		m.queuePolicy = p
+	}
+	return nil
 }
 
-// consumeAndSendDirectly reads messages from Kafka and immediately sends them to all active WebSocket connections.
-func consumeAndSendDirectly(topic string, instanceID string) {
+// consumeAndSendDirectly reads messages from Kafka and immediately sends them to all active WebSocket connections,
+// until ctx is canceled.
+func consumeAndSendDirectly(ctx context.Context, topic string, instanceID string) {
 	reader := createKafkaReader(topic, instanceID)
 	defer reader.Close()
+	consumerStates.add(topic, reader)
+	defer consumerStates.remove(topic)
 
+	logger := slog.With("topic", topic)
 	for {
-		msg, err := reader.ReadMessage(context.Background())
+		msg, err := reader.ReadMessage(ctx)
 		if err != nil {
-			if err.Error() == "context canceled" {
+			if ctx.Err() != nil {
 				return
 			}
-			log.Printf("Error reading Kafka message for topic %s: %v\n", topic, err)
+			logger.Error("Error reading Kafka message", "error", err)
+			consumerStates.recordError(topic, err)
 			continue
 		}
+		logger.Debug("Consumed Kafka message", "partition", msg.Partition, "offset", msg.Offset, "size", len(msg.Value))
+
+		// Continue the producer's trace, the span covers recording and broadcasting the message
+		msgCtx, span := startConsumeSpan(ctx, &msg)
+		span.SetAttributes(attribute.Int64("s81.message.age_ms", time.Since(msg.Time).Milliseconds()))
+
+		// Record the message before broadcasting it, so a client connecting in between gets it at least once
+		manager.broadcastMessage(msgCtx, manager.record(msg))
+		span.End()
+	}
+}
 
-		// Directly broadcast the message to all active connections
-		manager.broadcastMessage(msg)
-		// Update the latest message
-		manager.updateLatestMessage(topic, msg)
+// kafkaBroker returns the Kafka broker address from KAFKA_URL.
+func kafkaBroker() string {
+	if kafkaURL := os.Getenv("KAFKA_URL"); kafkaURL != "" {
+		return kafkaURL
 	}
+	return "localhost:9093"
 }
 
 // createKafkaReader creates a Kafka reader for the specified topic with a unique consumer group ID.
 func createKafkaReader(topic string, instanceID string) *kafka.Reader {
-	kafkaURL := os.Getenv("KAFKA_URL")
-	if kafkaURL == "" {
-		kafkaURL = "localhost:9093"
-	}
 	groupID := "websocket-broadcast-" + topic + "-" + instanceID
 	return kafka.NewReader(kafka.ReaderConfig{
-		Brokers:     []string{kafkaURL},
+		Brokers:     []string{kafkaBroker()},
 		Topic:       topic,
 		GroupID:     groupID,
 		StartOffset: kafka.LastOffset,
 	})
 }
 
-// broadcastMessage sends a Kafka message to all active WebSocket connections.
-func (m *ConnectionManager) broadcastMessage(msg kafka.Message) {
-	webSocketValue := WebSocketValue{
-		Key:   msg.Topic,
-		Value: string(msg.Value),
-	}
+// broadcastMessage sends a Kafka message to all active WebSocket connections, in a fan-out span under ctx.
+func (m *ConnectionManager) broadcastMessage(ctx context.Context, msg sequencedMessage) {
+	start := time.Now()
+	defer func() { broadcastDuration.Observe(time.Since(start).Seconds()) }()
+	messagesBroadcast.WithLabelValues(msg.Topic).Inc()
+
+	_, span := tracer.Start(ctx, "fan-out "+msg.Topic, trace.WithAttributes(attribute.Int64("s81.seq", int64(msg.seq))))
+	defer span.End()
 
-	jsonValue, err := json.Marshal(webSocketValue)
+	encoded, err := encodeMessage(msg)
 	if err != nil {
-		log.Printf("Error marshaling WebSocketValue: %v\n", err)
+		slog.Error("Error marshaling WebSocketValue", "topic", msg.Topic, "offset", msg.Offset, "error", err)
+		span.SetStatus(codes.Error, err.Error())
 		return
 	}
 
 	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	for conn := range m.connections {
-		conn.SetWriteDeadline(time.Now().Add(writeWait))
-		err := conn.WriteMessage(websocket.TextMessage, jsonValue)
-		if err != nil {
-			log.Printf("Error writing message to WebSocket: %v\n", err)
-			m.removeAndCloseConnection(conn)
+	var slow []*Client
+	delivered := 0
+	for client := range m.connections {
+		if !client.isSubscribed(msg.Topic) {
+			continue
+		}
+		if !client.enqueue(encoded.outbound(client.protocol)) {
+			slow = append(slow, client)
+			continue
 		}
+		delivered++
+	}
+	m.mu.RUnlock()
+
+	// Remove clients outside the read lock, removeAndCloseConnection takes the write lock
+	for _, client := range slow {
+		client.logger.Warn("Send queue full, disconnecting slow client", "topic", msg.Topic)
+		m.removeAndCloseConnection(client, reasonSlowClient)
 	}
+	span.SetAttributes(attribute.Int("s81.clients.delivered", delivered), attribute.Int("s81.clients.slow", len(slow)))
+	slog.Debug("Broadcast Kafka message", "topic", msg.Topic, "offset", msg.Offset, "seq", msg.seq,
+		"clients", delivered, "size", len(msg.Value))
 }
 
-// addConnection adds a new WebSocket connection to the manager and sends the latest messages.
-func (m *ConnectionManager) addConnection(conn *websocket.Conn) {
+// addConnection adds a new WebSocket connection to the manager and starts its writer. It returns false if the
+// server is shutting down, in which case the client is asked to go away.
+func (m *ConnectionManager) addConnection(client *Client) bool {
 	m.mu.Lock()
-	m.connections[conn] = struct{}{}
+	m.connections[client] = struct{}{}
+	m.active.Add(1)
+	activeConnections.Inc()
+	closing := m.closing
 	m.mu.Unlock()
 
-	m.sendLatestMessages(conn)
+	// Start the writer before anything is replayed, so it drains the queue while broadcasts are enqueued too
+	go client.writeLoop()
+	if closing {
+		client.goAway()
+		return false
+	}
+	return true
+}
+
+// sendLatestMessages sends the messages missed since the client's resume position for each of the given topics,
+// or the latest message of each key of topics without one, and every active weather alert for the alerts topic. It is called
+// with the topics a subscribe added.
+func (m *ConnectionManager) sendLatestMessages(client *Client, replayTopics []string) {
+	m.replay(client, replayTopics, client.takeResume(replayTopics))
+}
+
+// sendSnapshot sends the latest message of each key for each of the given topics, or every active weather alert for the
+// alerts topic, whether or not the client is subscribed. Clients following deltas request it when they miss one.
+func (m *ConnectionManager) sendSnapshot(client *Client, snapshotTopics []string) {
+	m.replay(client, snapshotTopics, nil)
 }
 
-// sendLatestMessages sends the latest message for each topic to the new connection.
-func (m *ConnectionManager) sendLatestMessages(conn *websocket.Conn) {
+// replay sends the messages of each topic that followed the client's position, falling back to the snapshot
+// for topics without a position, whose next message is no longer in the history, or whose missed messages do not
+// fit in the client's send queue next to the rest of the replay.
+func (m *ConnectionManager) replay(client *Client, replayTopics []string, positions map[string]resumePosition) {
 	m.mu.RLock()
-	defer m.mu.RUnlock()
+	now := time.Now()
+	snapshots := make(map[string][]sequencedMessage, len(replayTopics))
+	budget := client.queueSize
+	for _, topic := range replayTopics {
+		snapshots[topic] = m.snapshotMessages(topic, now)
+		budget -= len(snapshots[topic])
+	}
 
-	for _, msg := range m.latestMessages {
-		webSocketValue := WebSocketValue{
-			Key:   msg.Topic,
-			Value: string(msg.Value),
+	var messages []sequencedMessage
+	for _, topic := range replayTopics {
+		if position, ok := positions[topic]; ok {
+			missed, ok := m.missedMessages(topic, position)
+			switch extra := len(missed) - len(snapshots[topic]); {
+			case !ok:
+				client.logger.Info("Resume position is no longer in the history, sending a snapshot", "topic", topic)
+			case extra > budget:
+				client.logger.Info("Missed messages exceed the send queue, sending a snapshot", "topic", topic,
+					"missed", len(missed), "queue_size", client.queueSize)
+			default:
+				budget -= extra
+				messages = append(messages, missed...)
+				continue
+			}
 		}
+		messages = append(messages, snapshots[topic]...)
+	}
+	m.mu.RUnlock()
 
-		jsonValue, err := json.Marshal(webSocketValue)
+	for _, msg := range messages {
+		encoded, err := encodeMessage(msg)
 		if err != nil {
-			log.Printf("Error marshaling WebSocketValue: %v\n", err)
+			slog.Error("Error marshaling WebSocketValue", "topic", msg.Topic, "offset", msg.Offset, "error", err)
 			continue
 		}
 
-		conn.SetWriteDeadline(time.Now().Add(writeWait))
-		if err := conn.WriteMessage(websocket.TextMessage, jsonValue); err != nil {
-			log.Printf("Error sending latest message to new WebSocket connection: %v\n", err)
-			m.removeAndCloseConnection(conn)
+		if !client.enqueue(encoded.outbound(client.protocol)) {
+			client.logger.Warn("Send queue full while replaying latest messages")
+			m.removeAndCloseConnection(client, reasonSlowClient)
 			return
 		}
 	}
 }
 
-// updateLatestMessage updates the latest message for a given topic.
-func (m *ConnectionManager) updateLatestMessage(topic string, msg kafka.Message) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.latestMessages[topic] = msg
+// missedMessages returns the messages of a topic after the position, or false if some are no longer in the history.
+// The caller must hold m.mu.
+func (m *ConnectionManager) missedMessages(topic string, position resumePosition) ([]sequencedMessage, bool) {
+	history, ok := m.history[topic]
+	if !ok {
+		return nil, false
+	}
+	return history.since(position)
 }
 
-// removeAndCloseConnection removes a WebSocket connection from the manager and ensures it's properly closed.
-func (m *ConnectionManager) removeAndCloseConnection(conn *websocket.Conn) {
+// snapshotMessages returns the latest message of each key of a topic in the order they were consumed, or every
+// active alert for the alerts topic. The caller must hold m.mu.
+func (m *ConnectionManager) snapshotMessages(topic string, now time.Time) []sequencedMessage {
+	if topic == alertsTopic {
+		return m.activeAlertMessages(now)
+	}
+	var latest []sequencedMessage
+	for _, msg := range m.latestMessages[topic] {
+		latest = append(latest, msg)
+	}
+	sort.Slice(latest, func(i, j int) bool {
+		return latest[i].seq < latest[j].seq
+	})
+	return latest
+}
+
+// record assigns the next sequence number to a consumed message and keeps it in the topic's history, and as the
+// latest message of its key or, for the alerts topic, the latest event of its alert. Producers publishing several
+// locations or stations to one topic tell them apart by key, so each key keeps its own latest message.
+func (m *ConnectionManager) record(msg kafka.Message) sequencedMessage {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Check if the connection is still in the map before attempting to remove and close it
-	if _, ok := m.connections[conn]; ok {
-		log.Println("Removing and closing connection due to error")
-		conn.Close()                // Close the WebSocket connection
-		delete(m.connections, conn) // Remove the connection from the map
+	m.sequence++
+	sequenced := sequencedMessage{Message: msg, seq: m.sequence}
+
+	history, ok := m.history[msg.Topic]
+	if !ok {
+		history = newRingBuffer(m.historySize)
+		m.history[msg.Topic] = history
 	}
+	history.add(sequenced)
+
+	if msg.Topic == alertsTopic {
+		m.updateActiveAlerts(sequenced)
+	} else {
+		latest, ok := m.latestMessages[msg.Topic]
+		if !ok {
+			latest = make(map[string]sequencedMessage)
+			m.latestMessages[msg.Topic] = latest
+		}
+		latest[string(msg.Key)] = sequenced
+	}
+	return sequenced
 }
 
-// ping sends ping messages to keep the WebSocket connection alive.
-func ping(conn *websocket.Conn) {
-	ticker := time.NewTicker(pingPeriod)
-	defer ticker.Stop()
+// removeAndCloseConnection removes a WebSocket connection from the manager and ensures it's properly closed.
+// The reason is counted for the first caller only.
+func (m *ConnectionManager) removeAndCloseConnection(client *Client, reason string) {
+	m.mu.Lock()
+	_, ok := m.connections[client]
+	delete(m.connections, client)
+	m.mu.Unlock()
 
-	for range ticker.C {
-		conn.SetWriteDeadline(time.Now().Add(writeWait))
-		if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-			log.Printf("Error writing ping message: %v\n", err)
-			manager.removeAndCloseConnection(conn) // Properly remove the connection if ping fails
-			return
-		}
+	// Only log for the first caller, the reader and writer both clean up on exit
+	if ok {
+		client.logger.Info("Removing and closing connection", "reason", reason)
+	}
+	client.close()
+	if ok {
+		activeConnections.Dec()
+		disconnects.WithLabelValues(reason).Inc()
+		m.active.Done()
 	}
 }
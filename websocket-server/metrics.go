@@ -0,0 +1,90 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons a connection was removed, used as the reason label of websocket_disconnects_total.
+const (
+	reasonClientClosed = "client_closed" // The client sent a close frame.
+	reasonReadError    = "read_error"    // Reading failed, including missed pongs.
+	reasonWriteError   = "write_error"
+	reasonSlowClient   = "slow_client" // The send queue was full with the disconnect policy.
+	reasonTokenExpired = "token_expired"
+	reasonShutdown     = "shutdown"
+)
+
+// Metrics served on /metrics.
+var (
+	activeConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "websocket_active_connections",
+		Help: "Number of open WebSocket connections.",
+	})
+	messagesBroadcast = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_messages_broadcast_total",
+		Help: "Kafka messages broadcast to clients, by topic.",
+	}, []string{"topic"})
+	bytesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_bytes_sent_total",
+		Help: "Payload bytes written to clients before compression, by topic.",
+	}, []string{"topic"})
+	writeErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "websocket_write_errors_total",
+		Help: "Failed writes to clients.",
+	})
+	disconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "websocket_disconnects_total",
+		Help: "Removed connections, by reason.",
+	}, []string{"reason"})
+	broadcastDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "websocket_broadcast_duration_seconds",
+		Help:    "Time to encode a Kafka message and queue it for every subscribed client.",
+		Buckets: prometheus.ExponentialBuckets(0.00005, 4, 8),
+	})
+)
+
+func init() {
+	prometheus.MustRegister(activeConnections, messagesBroadcast, bytesSent, writeErrors, disconnects, broadcastDuration,
+		serverMetrics)
+}
+
+// serverCollector reports the consumer lag and the age of the latest messages when /metrics is scraped.
+type serverCollector struct {
+	manager   *ConnectionManager
+	consumers *consumerRegistry
+}
+
+var serverMetrics = serverCollector{manager: manager, consumers: consumerStates}
+
+var (
+	consumerLagDesc = prometheus.NewDesc("websocket_kafka_consumer_lag",
+		"Messages the Kafka reader is behind the end of the topic.", []string{"topic"}, nil)
+	latestMessageAgeDesc = prometheus.NewDesc("websocket_latest_message_age_seconds",
+		"Age of the latest message replayed to new clients, from its Kafka timestamp.", []string{"topic"}, nil)
+)
+
+func (c serverCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- consumerLagDesc
+	ch <- latestMessageAgeDesc
+}
+
+func (c serverCollector) Collect(ch chan<- prometheus.Metric) {
+	for topic, reader := range c.consumers.readers() {
+		ch <- prometheus.MustNewConstMetric(consumerLagDesc, prometheus.GaugeValue, float64(reader.Stats().Lag), topic)
+	}
+
+	now := time.Now()
+	c.manager.mu.RLock()
+	for topic, latest := range c.manager.latestMessages {
+		var newest time.Time
+		for _, msg := range latest {
+			if msg.Time.After(newest) {
+				newest = msg.Time
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(latestMessageAgeDesc, prometheus.GaugeValue, now.Sub(newest).Seconds(), topic)
+	}
+	c.manager.mu.RUnlock()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/segmentio/kafka-go"
+)
+
+// newConnectedClient creates a client on the server side of a real WebSocket connection and returns it with the
+// client side of the connection.
+func newConnectedClient(t *testing.T) (*Client, *websocket.Conn) {
+	t.Helper()
+	clients := make(chan *Client, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counter := &countingResponseWriter{ResponseWriter: w}
+		conn, err := (&websocket.Upgrader{}).Upgrade(counter, r, nil)
+		if err != nil {
+			t.Error(err)
+			close(clients)
+			return
+		}
+		clients <- newClient(conn, counter.conn, false, 8, PolicyDisconnect)
+	}))
+	t.Cleanup(server.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { peer.Close() })
+	client, ok := <-clients
+	if !ok {
+		t.FailNow()
+	}
+	return client, peer
+}
+
+func TestConnectionMetrics(t *testing.T) {
+	m := newTestManager("weather-data", defaultHistorySize, 0)
+	client, _ := newConnectedClient(t)
+	active := testutil.ToFloat64(activeConnections)
+	closed := testutil.ToFloat64(disconnects.WithLabelValues(reasonClientClosed))
+
+	m.addConnection(client)
+	if got := testutil.ToFloat64(activeConnections) - active; got != 1 {
+		t.Fatalf("active connections changed by %v after connecting, expected 1", got)
+	}
+
+	// The reader and the writer both remove the connection, it is counted once
+	m.removeAndCloseConnection(client, reasonClientClosed)
+	m.removeAndCloseConnection(client, reasonReadError)
+	if got := testutil.ToFloat64(activeConnections) - active; got != 0 {
+		t.Fatalf("active connections changed by %v after disconnecting, expected 0", got)
+	}
+	if got := testutil.ToFloat64(disconnects.WithLabelValues(reasonClientClosed)) - closed; got != 1 {
+		t.Fatalf("counted %v client_closed disconnects, expected 1", got)
+	}
+}
+
+func TestBroadcastMetrics(t *testing.T) {
+	const topic = "weather-data"
+	m := newTestManager(topic, defaultHistorySize, 0)
+	client, peer := newConnectedClient(t)
+	m.addConnection(client)
+	defer m.removeAndCloseConnection(client, reasonClientClosed)
+	m.sendLatestMessages(client, client.subscribe([]string{topic}))
+
+	broadcast := testutil.ToFloat64(messagesBroadcast.WithLabelValues(topic))
+	sent := testutil.ToFloat64(bytesSent.WithLabelValues(topic))
+
+	value := []byte(`{"schemaVersion":1,"location":"s81"}`)
+	m.broadcastMessage(context.Background(), m.record(kafka.Message{Topic: topic, Offset: 1, Value: value}))
+
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, data, err := peer.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(messagesBroadcast.WithLabelValues(topic)) - broadcast; got != 1 {
+		t.Fatalf("counted %v broadcast messages, expected 1", got)
+	}
+	if got := testutil.ToFloat64(bytesSent.WithLabelValues(topic)) - sent; got != float64(len(data)) {
+		t.Fatalf("counted %v bytes sent, expected the %d bytes of the frame", got, len(data))
+	}
+}
+
+func TestServerCollector(t *testing.T) {
+	m := newTestManager("weather-data", defaultHistorySize, 0)
+	m.record(kafka.Message{Topic: "weather-data", Offset: 1, Time: time.Now().Add(-time.Minute)})
+	consumers := &consumerRegistry{topics: make(map[string]*consumerState)}
+	reader := kafka.NewReader(kafka.ReaderConfig{Brokers: []string{"localhost:0"}, Topic: "weather-data"})
+	defer reader.Close()
+	consumers.add("weather-data", reader)
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(serverCollector{manager: m, consumers: consumers})
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if label := metric.GetLabel(); len(label) != 1 || label[0].GetValue() != "weather-data" {
+				t.Fatalf("%s has labels %v, expected topic=weather-data", family.GetName(), label)
+			}
+			values[family.GetName()] = metric.GetGauge().GetValue()
+		}
+	}
+	if lag, ok := values["websocket_kafka_consumer_lag"]; !ok || lag != 0 {
+		t.Fatalf("consumer lag %v, expected 0 for a reader that read nothing", lag)
+	}
+	if age := values["websocket_latest_message_age_seconds"]; age < 60 || age > 70 {
+		t.Fatalf("latest message age %vs, expected about a minute", age)
+	}
+}
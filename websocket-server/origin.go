@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// OriginMode decides how the Origin header of WebSocket upgrades is checked.
+type OriginMode string
+
+const (
+	OriginStrict OriginMode = "strict" // Only same-origin requests and allowed origins may connect.
+	OriginDev    OriginMode = "dev"    // Every origin may connect, the ones outside the allowlist are logged. For local development only.
+)
+
+// OriginConfig controls which browser origins may open a WebSocket. Requests without an Origin header come from
+// clients other than browsers and are always accepted, as are requests from the server's own origin.
+type OriginConfig struct {
+	Mode    OriginMode
+	Allowed []originPattern
+}
+
+var origins = OriginConfig{Mode: OriginStrict}
+
+// originPattern is an allowed origin such as https://s81.example.com, or https://*.example.com for any subdomain.
+type originPattern struct {
+	scheme   string
+	host     string
+	port     string
+	wildcard bool // The host matches subdomains of host, but not host itself.
+}
+
+// loadOriginConfig reads the comma-separated ALLOWED_ORIGINS and the ORIGIN_MODE from the environment.
+func loadOriginConfig(c *OriginConfig) error {
+	if mode := os.Getenv("ORIGIN_MODE"); mode != "" {
+		switch m := OriginMode(mode); m {
+		case OriginStrict, OriginDev:
+			c.Mode = m
+		default:
+			return fmt.Errorf("unknown origin mode %q", mode)
+		}
+	}
+	for _, value := range strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		pattern, err := parseOriginPattern(value)
+		if err != nil {
+			return err
+		}
+		c.Allowed = append(c.Allowed, pattern)
+	}
+	return nil
+}
+
+// parseOriginPattern parses an allowed origin, which is a scheme and host with an optional port and a leading *.
+// wildcard.
+func parseOriginPattern(value string) (originPattern, error) {
+	scheme, host, ok := strings.Cut(strings.TrimSuffix(strings.ToLower(value), "/"), "://")
+	if !ok || scheme == "" || host == "" || strings.ContainsAny(host, "/?#@") {
+		return originPattern{}, fmt.Errorf("allowed origin %q must be scheme://host[:port]", value)
+	}
+
+	pattern := originPattern{scheme: scheme, host: host}
+	if hostname, port, err := net.SplitHostPort(host); err == nil {
+		pattern.host, pattern.port = hostname, port
+	}
+	pattern.port = normalizePort(scheme, pattern.port)
+	if rest, ok := strings.CutPrefix(pattern.host, "*."); ok {
+		pattern.host, pattern.wildcard = rest, true
+	}
+	if pattern.host == "" || strings.Contains(pattern.host, "*") {
+		return originPattern{}, fmt.Errorf("allowed origin %q may only use a wildcard for the leftmost label", value)
+	}
+	return pattern, nil
+}
+
+// normalizePort returns the port of an origin, or the default port of its scheme if it has none, so that
+// https://example.com and https://example.com:443 are the same origin.
+func normalizePort(scheme, port string) string {
+	if port != "" {
+		return port
+	}
+	switch strings.ToLower(scheme) {
+	case "https", "wss":
+		return "443"
+	case "http", "ws":
+		return "80"
+	}
+	return ""
+}
+
+// matches reports whether an origin has the pattern's scheme, host and port.
+func (p originPattern) matches(origin *url.URL) bool {
+	if !strings.EqualFold(origin.Scheme, p.scheme) || normalizePort(origin.Scheme, origin.Port()) != p.port {
+		return false
+	}
+	host := strings.ToLower(origin.Hostname())
+	if p.wildcard {
+		return strings.HasSuffix(host, "."+p.host)
+	}
+	return host == p.host
+}
+
+// check decides whether a request may be upgraded, returning the reason if it may not.
+func (c *OriginConfig) check(r *http.Request) error {
+	header := r.Header.Get("Origin")
+	if header == "" {
+		return nil
+	}
+	origin, err := url.Parse(header)
+	if err != nil || origin.Scheme == "" || origin.Host == "" {
+		return errors.New("malformed origin")
+	}
+	if strings.EqualFold(origin.Host, r.Host) {
+		return nil
+	}
+	for _, pattern := range c.Allowed {
+		if pattern.matches(origin) {
+			return nil
+		}
+	}
+	return errors.New("origin is not in ALLOWED_ORIGINS")
+}
+
+// checkOrigin is the upgrader's CheckOrigin, logging every upgrade it rejects.
+func checkOrigin(r *http.Request) bool {
+	err := origins.check(r)
+	if err == nil {
+		return true
+	}
+	if origins.Mode == OriginDev {
+		slog.Warn("Allowing WebSocket upgrade in dev mode", "origin", r.Header.Get("Origin"), "error", err)
+		return true
+	}
+	slog.Warn("Rejecting WebSocket upgrade", "origin", r.Header.Get("Origin"), "remote", r.RemoteAddr, "error", err)
+	return false
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestOriginCheck(t *testing.T) {
+	config := OriginConfig{Mode: OriginStrict}
+	for _, value := range []string{"https://s81.example.com", "https://*.example.org", "http://localhost:3000",
+		"https://secure.example.net:443", "http://plain.example.net"} {
+		pattern, err := parseOriginPattern(value)
+		if err != nil {
+			t.Fatalf("parsing %q: %v", value, err)
+		}
+		config.Allowed = append(config.Allowed, pattern)
+	}
+
+	tests := []struct {
+		name    string
+		origin  string
+		allowed bool
+	}{
+		{"no origin", "", true},
+		{"same origin", "http://ws.local:8081", true},
+		{"exact match", "https://s81.example.com", true},
+		{"exact match ignores case", "HTTPS://S81.Example.COM", true},
+		{"other host", "https://evil.example.com", false},
+		{"suffix of an allowed host", "https://evils81.example.com", false},
+		{"wildcard subdomain", "https://app.example.org", true},
+		{"wildcard nested subdomain", "https://a.b.example.org", true},
+		{"wildcard does not match the apex", "https://example.org", false},
+		{"wildcard does not match a suffix", "https://badexample.org", false},
+		{"port match", "http://localhost:3000", true},
+		{"port mismatch", "http://localhost:3001", false},
+		{"missing port", "http://localhost", false},
+		{"default https port in the origin", "https://s81.example.com:443", true},
+		{"default https port in the pattern", "https://secure.example.net", true},
+		{"default http port in the origin", "http://plain.example.net:80", true},
+		{"other port than the default", "https://s81.example.com:8443", false},
+		{"scheme mismatch", "http://s81.example.com", false},
+		{"scheme mismatch on the default port", "http://s81.example.com:443", false},
+		{"null origin", "null", false},
+		{"malformed origin", "://", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest(http.MethodGet, "http://ws.local:8081/ws", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if err := config.check(r); (err == nil) != tt.allowed {
+				t.Fatalf("origin %q: allowed %v, expected %v (%v)", tt.origin, err == nil, tt.allowed, err)
+			}
+		})
+	}
+}
+
+func TestParseOriginPattern(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected originPattern
+		valid    bool
+	}{
+		{"https://s81.example.com", originPattern{scheme: "https", host: "s81.example.com", port: "443"}, true},
+		{"https://s81.example.com/", originPattern{scheme: "https", host: "s81.example.com", port: "443"}, true},
+		{"http://localhost:3000", originPattern{scheme: "http", host: "localhost", port: "3000"}, true},
+		{"https://*.example.com", originPattern{scheme: "https", host: "example.com", port: "443", wildcard: true}, true},
+		{"s81.example.com", originPattern{}, false},
+		{"https://", originPattern{}, false},
+		{"https://s81.example.com/path", originPattern{}, false},
+		{"https://*", originPattern{}, false},
+		{"https://a.*.example.com", originPattern{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			pattern, err := parseOriginPattern(tt.value)
+			if (err == nil) != tt.valid {
+				t.Fatalf("valid %v, expected %v (%v)", err == nil, tt.valid, err)
+			}
+			if pattern != tt.expected {
+				t.Fatalf("pattern %+v, expected %+v", pattern, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultShutdownTimeout = 8 * time.Second // Default drain deadline, below the 10 seconds Docker waits before killing.
+
+// loadShutdownTimeout reads the drain deadline from SHUTDOWN_TIMEOUT.
+func loadShutdownTimeout() (time.Duration, error) {
+	env := os.Getenv("SHUTDOWN_TIMEOUT")
+	if env == "" {
+		return defaultShutdownTimeout, nil
+	}
+	timeout, err := time.ParseDuration(env)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("SHUTDOWN_TIMEOUT must be a positive duration, got %q", env)
+	}
+	return timeout, nil
+}
+
+// shutdown stops accepting connections, asks every client to go away and waits until the connections are closed
+// and the consumers have stopped, or until ctx is done.
+func shutdown(ctx context.Context, server *http.Server, consumers *sync.WaitGroup) {
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("Error shutting down HTTP server", "error", err)
+	}
+	manager.goAway()
+
+	if !waitGroup(ctx, &manager.active) {
+		slog.Warn("Shutdown deadline reached, closing remaining connections")
+		manager.closeAll()
+	}
+	if !waitGroup(ctx, consumers) {
+		slog.Warn("Shutdown deadline reached before the Kafka consumers stopped")
+	}
+}
+
+// goAway asks every connected client to go away and makes new connections do the same.
+func (m *ConnectionManager) goAway() {
+	m.mu.Lock()
+	m.closing = true
+	clients := make([]*Client, 0, len(m.connections))
+	for client := range m.connections {
+		clients = append(clients, client)
+	}
+	m.mu.Unlock()
+
+	slog.Info("Closing WebSocket connections", "connections", len(clients))
+	for _, client := range clients {
+		client.goAway()
+	}
+}
+
+// closeAll closes every remaining connection without waiting for the clients.
+func (m *ConnectionManager) closeAll() {
+	m.mu.RLock()
+	clients := make([]*Client, 0, len(m.connections))
+	for client := range m.connections {
+		clients = append(clients, client)
+	}
+	m.mu.RUnlock()
+
+	for _, client := range clients {
+		m.removeAndCloseConnection(client, reasonShutdown)
+	}
+}
+
+// waitGroup waits for a WaitGroup, returning false if ctx is done first.
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+
+	"github.com/michael-hauser/s81/telemetry"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the consumers and broadcasts. It delegates to the provider installed by telemetry.Setup.
+var tracer = otel.Tracer(serviceName)
+
+// startConsumeSpan starts a span for a consumed message, continuing the trace of the producer that published it.
+func startConsumeSpan(ctx context.Context, msg *kafka.Message) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, telemetry.HeaderCarrier{Headers: &msg.Headers})
+	return tracer.Start(ctx, "consume "+msg.Topic,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKafka,
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingKafkaDestinationPartition(msg.Partition),
+			semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+			semconv.MessagingMessageBodySize(len(msg.Value)),
+		),
+	)
+}